@@ -0,0 +1,320 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BucketedHistograms count float64 values in buckets with fixed upper bounds,
+// without sampling, as well as their count and sum.
+type BucketedHistogram interface {
+	Bounds() []float64
+	BucketCounts() []int64
+	Clear()
+	Count() int64
+	Exemplars() []*Exemplar
+	Snapshot() BucketedHistogram
+	Sum() float64
+	Update(float64)
+	UpdateWithExemplar(float64, Labels)
+}
+
+// DefaultBuckets are upper bounds suited to request latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LinearBuckets returns count upper bounds, the lowest being start and each
+// following bound width greater than the one before it.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if count < 1 || width <= 0 {
+		panic(fmt.Sprintf("metrics: invalid linear buckets: width %v, count %d", width, count))
+	}
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBuckets returns count upper bounds, the lowest being start and
+// each following bound factor times the one before it.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 || start <= 0 || factor <= 1 {
+		panic(fmt.Sprintf("metrics: invalid exponential buckets: start %v, factor %v, count %d", start, factor, count))
+	}
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// NewBucketedHistogram constructs a new StandardBucketedHistogram with the
+// given upper bounds, in increasing order. A final bucket holding every value
+// greater than the highest bound is always added. Nil bounds use
+// DefaultBuckets. It panics if the bounds are not increasing.
+func NewBucketedHistogram(bounds []float64) BucketedHistogram {
+	if bounds == nil {
+		bounds = DefaultBuckets
+	}
+	if n := len(bounds); n > 0 && math.IsInf(bounds[n-1], 1) {
+		bounds = bounds[:n-1]
+	}
+	for i, b := range bounds {
+		if math.IsNaN(b) || (i > 0 && b <= bounds[i-1]) {
+			panic(fmt.Sprintf("metrics: bucket bounds %v are not increasing", bounds))
+		}
+	}
+	h := &StandardBucketedHistogram{
+		bounds:    make([]float64, len(bounds)),
+		counts:    make([]int64, len(bounds)+1),
+		exemplars: make([]*Exemplar, len(bounds)+1),
+		created:   time.Now(),
+	}
+	copy(h.bounds, bounds)
+	return h
+}
+
+// NewRegisteredBucketedHistogram constructs and registers a new
+// StandardBucketedHistogram with the given upper bounds.
+func NewRegisteredBucketedHistogram(name string, r Registry, bounds []float64) BucketedHistogram {
+	c := NewBucketedHistogram(bounds)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetBucketedHistogram returns an existing BucketedHistogram
+func GetBucketedHistogram(name string, r Registry) BucketedHistogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(BucketedHistogram)
+}
+
+// BucketedHistogramSnapshot is a read-only copy of another BucketedHistogram.
+type BucketedHistogramSnapshot struct {
+	bounds    []float64
+	counts    []int64
+	exemplars []*Exemplar
+	count     int64
+	sum       float64
+}
+
+// Bounds returns the upper bounds of the buckets at the time the snapshot was
+// taken.
+func (h *BucketedHistogramSnapshot) Bounds() []float64 { return h.bounds }
+
+// BucketCounts returns the number of values counted in each bucket at the
+// time the snapshot was taken.
+func (h *BucketedHistogramSnapshot) BucketCounts() []int64 { return h.counts }
+
+// Clear panics.
+func (*BucketedHistogramSnapshot) Clear() {
+	panic("Clear called on a BucketedHistogramSnapshot")
+}
+
+// Count returns the number of values recorded at the time the snapshot was
+// taken.
+func (h *BucketedHistogramSnapshot) Count() int64 { return h.count }
+
+// Exemplars returns the exemplar of each bucket at the time the snapshot was
+// taken.
+func (h *BucketedHistogramSnapshot) Exemplars() []*Exemplar { return h.exemplars }
+
+// Snapshot returns the snapshot.
+func (h *BucketedHistogramSnapshot) Snapshot() BucketedHistogram { return h }
+
+// Sum returns the sum of the values recorded at the time the snapshot was
+// taken.
+func (h *BucketedHistogramSnapshot) Sum() float64 { return h.sum }
+
+// Update panics.
+func (*BucketedHistogramSnapshot) Update(float64) {
+	panic("Update called on a BucketedHistogramSnapshot")
+}
+
+// UpdateWithExemplar panics.
+func (*BucketedHistogramSnapshot) UpdateWithExemplar(float64, Labels) {
+	panic("UpdateWithExemplar called on a BucketedHistogramSnapshot")
+}
+
+// MarshalMetric returns the count, sum and cumulative bucket counts of the
+// snapshot, as output by the registry.
+func (h *BucketedHistogramSnapshot) MarshalMetric() (interface{}, error) {
+	return bucketedHistogramValue(h), nil
+}
+
+// StandardBucketedHistogram is the standard implementation of a
+// BucketedHistogram.
+type StandardBucketedHistogram struct {
+	bounds    []float64
+	mutex     sync.Mutex
+	counts    []int64
+	exemplars []*Exemplar
+	count     int64
+	sum       float64
+	created   time.Time
+}
+
+// Bounds returns the upper bounds of the buckets, not including the final
+// bucket for values greater than every bound.
+func (h *StandardBucketedHistogram) Bounds() []float64 {
+	bounds := make([]float64, len(h.bounds))
+	copy(bounds, h.bounds)
+	return bounds
+}
+
+// BucketCounts returns the number of values counted in each bucket. The last
+// count is of the values greater than every bound.
+func (h *StandardBucketedHistogram) BucketCounts() []int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	counts := make([]int64, len(h.counts))
+	copy(counts, h.counts)
+	return counts
+}
+
+// Clear resets every bucket, the count and the sum to zero, and removes the
+// exemplars.
+func (h *StandardBucketedHistogram) Clear() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i := range h.counts {
+		h.counts[i] = 0
+		h.exemplars[i] = nil
+	}
+	h.count = 0
+	h.sum = 0
+	h.created = time.Now()
+}
+
+// Count returns the number of values recorded.
+func (h *StandardBucketedHistogram) Count() int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+// Exemplars returns the most recent exemplar recorded by UpdateWithExemplar
+// in each bucket, nil for the buckets without one.
+func (h *StandardBucketedHistogram) Exemplars() []*Exemplar {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	exemplars := make([]*Exemplar, len(h.exemplars))
+	copy(exemplars, h.exemplars)
+	return exemplars
+}
+
+// Snapshot returns a consistent read-only copy of the histogram.
+func (h *StandardBucketedHistogram) Snapshot() BucketedHistogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	counts := make([]int64, len(h.counts))
+	copy(counts, h.counts)
+	exemplars := make([]*Exemplar, len(h.exemplars))
+	copy(exemplars, h.exemplars)
+	return &BucketedHistogramSnapshot{
+		bounds:    h.bounds,
+		counts:    counts,
+		exemplars: exemplars,
+		count:     h.count,
+		sum:       h.sum,
+	}
+}
+
+// Sum returns the sum of the values recorded.
+func (h *StandardBucketedHistogram) Sum() float64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.sum
+}
+
+// Update counts a new value in the lowest bucket whose bound is greater than
+// or equal to it. NaN, which is in no bucket, is ignored.
+func (h *StandardBucketedHistogram) Update(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+// UpdateWithExemplar counts a new value, as Update does, and records it, with
+// the given labels such as a trace ID, as the exemplar of its bucket. The
+// exemplar is not recorded if its labels are longer than
+// MaxExemplarLabelLength.
+func (h *StandardBucketedHistogram) UpdateWithExemplar(v float64, labels Labels) {
+	h.updateWithExemplar(time.Now(), v, labels)
+}
+
+func (h *StandardBucketedHistogram) updateWithExemplar(now time.Time, v float64, labels Labels) {
+	if math.IsNaN(v) {
+		return
+	}
+	e := newExemplar(now, v, labels)
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	if e != nil {
+		h.exemplars[i] = e
+	}
+}
+
+// createdTime returns the time the histogram was created or last cleared.
+func (h *StandardBucketedHistogram) createdTime() time.Time {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.created
+}
+
+// MarshalMetric returns the count, sum and cumulative bucket counts of the
+// histogram, as output by the registry.
+func (h *StandardBucketedHistogram) MarshalMetric() (interface{}, error) {
+	return bucketedHistogramValue(h.Snapshot()), nil
+}
+
+// bucketedHistogramValue returns the values a BucketedHistogram is output
+// as. The sum of infinite values is output as a string, as JSON has no
+// infinities.
+func bucketedHistogramValue(h BucketedHistogram) map[string]interface{} {
+	return map[string]interface{}{
+		"count":   h.Count(),
+		"sum":     jsonFloat64(h.Sum()),
+		"buckets": cumulativeBuckets(h),
+	}
+}
+
+// cumulativeBuckets returns the number of values less than or equal to each
+// bound of a histogram, keyed by the bound written as the le label of the
+// exposition formats, and the count keyed by "+Inf".
+func cumulativeBuckets(h BucketedHistogram) map[string]int64 {
+	bounds, counts := h.Bounds(), h.BucketCounts()
+	buckets := make(map[string]int64, len(counts))
+	var cumulative int64
+	for i, c := range counts {
+		cumulative += c
+		if i < len(bounds) {
+			buckets[formatFloat(bounds[i])] = cumulative
+		} else {
+			buckets["+Inf"] = cumulative
+		}
+	}
+	return buckets
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func BenchmarkBucketedHistogram(b *testing.B) {
+	h := NewBucketedHistogram(DefaultBuckets)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(float64(i%1000) / 100)
+	}
+}
+
+func TestBucketedHistogram(t *testing.T) {
+	h := NewBucketedHistogram([]float64{1, 2, 5})
+	for _, v := range []float64{0.5, 1, 1.5, 2, 3, 4.5, 10, -1} {
+		h.Update(v)
+	}
+	if counts := h.BucketCounts(); !reflect.DeepEqual([]int64{3, 2, 2, 1}, counts) {
+		t.Errorf("h.BucketCounts(): [3 2 2 1] != %v\n", counts)
+	}
+	if count := h.Count(); 8 != count {
+		t.Errorf("h.Count(): 8 != %v\n", count)
+	}
+	if sum := h.Sum(); 21.5 != sum {
+		t.Errorf("h.Sum(): 21.5 != %v\n", sum)
+	}
+	h.Clear()
+	if count, sum := h.Count(), h.Sum(); 0 != count || 0 != sum {
+		t.Errorf("h.Count(), h.Sum() after clear: %v, %v\n", count, sum)
+	}
+}
+
+func TestBucketedHistogramSnapshot(t *testing.T) {
+	h := NewBucketedHistogram([]float64{1})
+	h.Update(0.5)
+	snapshot := h.Snapshot()
+	h.Update(2)
+	if counts := snapshot.BucketCounts(); !reflect.DeepEqual([]int64{1, 0}, counts) {
+		t.Errorf("snapshot.BucketCounts(): [1 0] != %v\n", counts)
+	}
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestBucketedHistogramConcurrent(t *testing.T) {
+	h := NewBucketedHistogram(LinearBuckets(0, 10, 10))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.Update(float64(j % 100))
+			}
+		}()
+	}
+	wg.Wait()
+	if count := h.Count(); 8000 != count {
+		t.Errorf("h.Count(): 8000 != %v\n", count)
+	}
+}
+
+func TestBucketedHistogramInvalid(t *testing.T) {
+	for _, bounds := range [][]float64{{1, 1}, {2, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewBucketedHistogram(%v) did not panic\n", bounds)
+				}
+			}()
+			NewBucketedHistogram(bounds)
+		}()
+	}
+}
+
+func TestLinearBuckets(t *testing.T) {
+	if bounds := LinearBuckets(1, 2, 4); !reflect.DeepEqual([]float64{1, 3, 5, 7}, bounds) {
+		t.Errorf("LinearBuckets(1, 2, 4): [1 3 5 7] != %v\n", bounds)
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	if bounds := ExponentialBuckets(1, 10, 4); !reflect.DeepEqual([]float64{1, 10, 100, 1000}, bounds) {
+		t.Errorf("ExponentialBuckets(1, 10, 4): [1 10 100 1000] != %v\n", bounds)
+	}
+}
+
+func TestGetBucketedHistogram(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredBucketedHistogram("foo", r, nil).Update(0.2)
+	if h := GetBucketedHistogram("foo", r); 1 != h.Count() {
+		t.Fatal(h)
+	}
+}
+
+func TestRegistryBucketedHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredBucketedHistogram("size", r, ExponentialBuckets(1, 1000, 3))
+	for _, v := range []float64{1, 500, 2000, 3000, 5e6} {
+		h.Update(v)
+	}
+	values := registryValues(t, r)["size"].(map[string]interface{})
+	if count := values["count"]; 5.0 != count {
+		t.Errorf("count: 5 != %v\n", count)
+	}
+	if sum := values["sum"]; 5005501.0 != sum {
+		t.Errorf("sum: 5005501 != %v\n", sum)
+	}
+	expected := map[string]interface{}{"1": 1.0, "1000": 2.0, "1000000": 4.0, "+Inf": 5.0}
+	if buckets := values["buckets"]; !reflect.DeepEqual(expected, buckets) {
+		t.Errorf("buckets: %v != %v\n", expected, buckets)
+	}
+}
+
+func TestBucketedHistogramNaN(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredBucketedHistogram("size", r, []float64{1})
+	h.Update(0.5)
+	h.Update(math.NaN())
+	h.UpdateWithExemplar(math.NaN(), Labels{"trace_id": "a"})
+	if count, sum := h.Count(), h.Sum(); 1 != count || 0.5 != sum {
+		t.Errorf("h.Count(), h.Sum(): %v, %v\n", count, sum)
+	}
+	if sum := registryValues(t, r)["size"].(map[string]interface{})["sum"]; 0.5 != sum {
+		t.Errorf("sum: 0.5 != %v\n", sum)
+	}
+}
+
+func TestBucketedHistogramInf(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredBucketedHistogram("size", r, []float64{1})
+	h.Update(math.Inf(1))
+	values := registryValues(t, r)["size"].(map[string]interface{})
+	if sum := values["sum"]; "+Inf" != sum {
+		t.Errorf("sum: +Inf != %v\n", sum)
+	}
+	if count := values["count"]; 1.0 != count {
+		t.Errorf("count: 1 != %v\n", count)
+	}
+}
+
+func TestBucketedHistogramExemplars(t *testing.T) {
+	h := NewBucketedHistogram([]float64{1, 10})
+	h.UpdateWithExemplar(5, Labels{"trace_id": "a"})
+	h.UpdateWithExemplar(7, Labels{"trace_id": "b"})
+	h.Update(20)
+	snapshot := h.Snapshot()
+	h.UpdateWithExemplar(0.5, Labels{"trace_id": "c"})
+	exemplars := snapshot.Exemplars()
+	if nil != exemplars[0] || nil != exemplars[2] {
+		t.Errorf("snapshot.Exemplars(): %v\n", exemplars)
+	}
+	if e := exemplars[1]; nil == e || 7 != e.Value || "b" != e.Labels["trace_id"] {
+		t.Errorf("snapshot.Exemplars()[1]: %v\n", e)
+	}
+	if counts := snapshot.BucketCounts(); 2 != counts[1] {
+		t.Errorf("snapshot.BucketCounts()[1]: 2 != %v\n", counts[1])
+	}
+	h.Clear()
+	for i, e := range h.Exemplars() {
+		if nil != e {
+			t.Errorf("h.Exemplars()[%d] after clear: %v\n", i, e)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"os"
 	"sync/atomic"
+	"time"
 )
 
 // Counters hold an int64 value that can be incremented and decremented.
@@ -16,7 +17,7 @@ type Counter interface {
 
 // NewCounter constructs a new StandardCounter.
 func NewCounter() Counter {
-	return &StandardCounter{0}
+	return &StandardCounter{created: time.Now().UnixNano()}
 }
 
 // NewRegisteredCounter constructs and registers a new StandardCounter.
@@ -25,7 +26,7 @@ func NewRegisteredCounter(name string, r Registry) Counter {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, c)
+	err := registerCreated(r, name, c)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -41,14 +42,19 @@ func GetCounter(name string, r Registry) Counter {
 }
 
 // StandardCounter is the standard implementation of a Counter and uses the
-// sync/atomic package to manage a single int64 value.
+// sync/atomic package to manage a single int64 value. It is also an
+// ExemplarCounter.
 type StandardCounter struct {
-	count int64
+	count    int64
+	created  int64
+	exemplar atomic.Pointer[Exemplar]
 }
 
-// Clear sets the counter to zero.
+// Clear sets the counter to zero and removes its exemplar.
 func (c *StandardCounter) Clear() {
 	atomic.StoreInt64(&c.count, 0)
+	c.reset()
+	c.exemplar.Store(nil)
 }
 
 // Count returns the current count.
@@ -56,17 +62,71 @@ func (c *StandardCounter) Count() int64 {
 	return atomic.LoadInt64(&c.count)
 }
 
-// Dec decrements the counter by the given amount.
+// Dec decrements the counter by the given amount. As OpenMetrics counters
+// only go up, decrementing the counter restarts the time it is output as
+// created at, so that readers take the lower count for a reset.
 func (c *StandardCounter) Dec(i int64) {
 	atomic.AddInt64(&c.count, -i)
+	if i > 0 {
+		c.reset()
+	}
+}
+
+// Exemplar returns the most recent exemplar recorded by IncWithExemplar, or
+// nil if none is recorded.
+func (c *StandardCounter) Exemplar() *Exemplar {
+	return c.exemplar.Load()
 }
 
-// Inc increments the counter by the given amount.
+// Inc increments the counter by the given amount. A negative amount
+// decrements the counter, as Dec does.
 func (c *StandardCounter) Inc(i int64) {
 	atomic.AddInt64(&c.count, i)
+	if i < 0 {
+		c.reset()
+	}
+}
+
+// IncWithExemplar increments the counter by the given amount and records the
+// increment, with the given labels such as a trace ID, as the exemplar of the
+// counter. The exemplar is not recorded if its labels are longer than
+// MaxExemplarLabelLength.
+func (c *StandardCounter) IncWithExemplar(i int64, labels Labels) {
+	c.incWithExemplar(time.Now(), i, labels)
 }
 
-// Set changes the counter to the given value.
+func (c *StandardCounter) incWithExemplar(now time.Time, i int64, labels Labels) {
+	atomic.AddInt64(&c.count, i)
+	if i < 0 {
+		c.reset()
+	}
+	if e := newExemplar(now, float64(i), labels); e != nil {
+		c.exemplar.Store(e)
+	}
+}
+
+// Set changes the counter to the given value. Setting it to a lower value
+// restarts the time it is output as created at, as Dec does.
 func (c *StandardCounter) Set(i int64) {
-	atomic.StoreInt64(&c.count, i)
+	if old := atomic.SwapInt64(&c.count, i); i < old {
+		c.reset()
+	}
+}
+
+// MarshalMetric returns the current count, as output by the registry.
+func (c *StandardCounter) MarshalMetric() (interface{}, error) {
+	return c.Count(), nil
+}
+
+// reset restarts the time the counter is output as created at.
+func (c *StandardCounter) reset() {
+	atomic.StoreInt64(&c.created, time.Now().UnixNano())
+}
+
+// createdTime returns the time the counter was created or last went down.
+func (c *StandardCounter) createdTime() time.Time {
+	if created := atomic.LoadInt64(&c.created); created != 0 {
+		return time.Unix(0, created)
+	}
+	return time.Time{}
 }
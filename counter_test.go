@@ -35,6 +35,27 @@ func TestCounterDec2(t *testing.T) {
 	}
 }
 
+func TestCounterDecResetsCreated(t *testing.T) {
+	c := NewCounter().(*StandardCounter)
+	for _, tc := range []struct {
+		name  string
+		f     func()
+		reset bool
+	}{
+		{"c.Inc(3)", func() { c.Inc(3) }, false},
+		{"c.Set(5)", func() { c.Set(5) }, false},
+		{"c.Dec(1)", func() { c.Dec(1) }, true},
+		{"c.Inc(-1)", func() { c.Inc(-1) }, true},
+		{"c.Set(1)", func() { c.Set(1) }, true},
+	} {
+		c.created = 1
+		tc.f()
+		if reset := 1 != c.created; tc.reset != reset {
+			t.Errorf("%s reset the created time: %v != %v\n", tc.name, tc.reset, reset)
+		}
+	}
+}
+
 func TestCounterInc1(t *testing.T) {
 	c := NewCounter()
 	c.Inc(1)
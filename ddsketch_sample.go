@@ -0,0 +1,496 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// DefaultDDSketchMaxBins is the number of bins each sign of a DDSketchSample
+// keeps at most. With a relative accuracy of 1% it covers every int64 value.
+const DefaultDDSketchMaxBins = 4096
+
+// maxDDSketchMaxBins bounds the bins of a sketch, so that a corrupt encoding
+// cannot make a decoded sketch allocate more memory than 8 MiB for each sign.
+const maxDDSketchMaxBins = 1 << 20
+
+// DDSketchSample is a sample backed by a DDSketch, which counts values in
+// logarithmically sized bins so every percentile is within a relative error
+// of the true value, even for values spanning many orders of magnitude.
+// Positive and negative values are counted separately. Once a sign needs
+// more bins than its limit, the bins closest to zero are collapsed, trading
+// accuracy for the smallest values for bounded memory. Sketches recorded by
+// different registries or processes can be merged into one with Merge.
+// Count, Min, Max, Sum and Mean are exact. See Masson et al's "DDSketch: A
+// Fast and Fully-Mergeable Quantile Sketch with Relative-Error Guarantees".
+//
+// <https://arxiv.org/abs/1908.10693>
+type DDSketchSample struct {
+	relativeAccuracy float64
+	logGamma         float64
+	maxBins          int
+
+	mutex     sync.Mutex
+	positive  ddsketchStore
+	negative  ddsketchStore
+	zeroCount int64
+	stats     sampleStats
+}
+
+// ddsketchStore counts values in contiguous bins, starting at the bin of
+// index offset.
+type ddsketchStore struct {
+	offset int
+	counts []int64
+}
+
+// NewDDSketchSample constructs a new DDSketch sample whose percentiles are
+// within the given relative accuracy, such as 0.01 for 1%, keeping at most
+// DefaultDDSketchMaxBins bins for each sign.
+func NewDDSketchSample(relativeAccuracy float64) Sample {
+	return NewCollapsingDDSketchSample(relativeAccuracy, DefaultDDSketchMaxBins)
+}
+
+// NewCollapsingDDSketchSample constructs a new DDSketch sample whose
+// percentiles are within the given relative accuracy, keeping at most maxBins
+// bins for each sign. It panics if the relative accuracy is not between 0 and
+// 1 or maxBins is not between 1 and 1<<20.
+func NewCollapsingDDSketchSample(relativeAccuracy float64, maxBins int) Sample {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		panic(fmt.Sprintf("metrics: DDSketch relative accuracy %v must be between 0 and 1", relativeAccuracy))
+	}
+	if maxBins < 1 || maxBins > maxDDSketchMaxBins {
+		panic(fmt.Sprintf("metrics: DDSketch bins %d must be between 1 and %d", maxBins, maxDDSketchMaxBins))
+	}
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &DDSketchSample{
+		relativeAccuracy: relativeAccuracy,
+		logGamma:         math.Log(gamma),
+		maxBins:          maxBins,
+		stats:            newSampleStats(),
+	}
+}
+
+// Clear clears all samples.
+func (s *DDSketchSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.positive = ddsketchStore{}
+	s.negative = ddsketchStore{}
+	s.zeroCount = 0
+	s.stats = newSampleStats()
+}
+
+// Count returns the number of samples recorded.
+func (s *DDSketchSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.count
+}
+
+// Max returns the maximum value ever recorded.
+func (s *DDSketchSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.Max()
+}
+
+// Mean returns the mean of the recorded values.
+func (s *DDSketchSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.mean
+}
+
+// Merge adds the values recorded by another DDSketchSample with the same
+// relative accuracy to this sample. It returns an error wrapping
+// ErrIncompatibleSample otherwise.
+func (s *DDSketchSample) Merge(other Sample) error {
+	o, ok := other.(*DDSketchSample)
+	if !ok {
+		return fmt.Errorf("%w: cannot merge %T into %T", ErrIncompatibleSample, other, s)
+	}
+	if o == s {
+		return fmt.Errorf("%w: cannot merge a sample into itself", ErrIncompatibleSample)
+	}
+	if o.relativeAccuracy != s.relativeAccuracy {
+		return fmt.Errorf("%w: relative accuracy %v differs from %v", ErrIncompatibleSample, o.relativeAccuracy, s.relativeAccuracy)
+	}
+	o.mutex.Lock()
+	positive, negative := o.positive.copy(), o.negative.copy()
+	zeroCount, stats := o.zeroCount, o.stats
+	o.mutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, c := range positive.counts {
+		s.positive.add(positive.offset+i, c, s.maxBins)
+	}
+	for i, c := range negative.counts {
+		s.negative.add(negative.offset+i, c, s.maxBins)
+	}
+	s.zeroCount += zeroCount
+	s.stats.merge(stats)
+	return nil
+}
+
+// Min returns the minimum value ever recorded.
+func (s *DDSketchSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.Min()
+}
+
+// Percentile returns an arbitrary percentile of the recorded values, within
+// the sample's relative accuracy.
+func (s *DDSketchSample) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the recorded
+// values, within the sample's relative accuracy.
+func (s *DDSketchSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	scores := make([]float64, len(ps))
+	if 0 == s.stats.count {
+		return scores
+	}
+	for i, p := range ps {
+		scores[i] = s.quantile(p)
+	}
+	return scores
+}
+
+// Size returns the number of distinct bins values have been counted in.
+func (s *DDSketchSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	size := s.positive.size() + s.negative.size()
+	if s.zeroCount > 0 {
+		size++
+	}
+	return size
+}
+
+// StdDev returns the standard deviation of the recorded values.
+func (s *DDSketchSample) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the recorded values.
+func (s *DDSketchSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.sum
+}
+
+// Update records a new value.
+func (s *DDSketchSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats.update(v)
+	switch {
+	case v > 0:
+		s.positive.add(s.index(float64(v)), 1, s.maxBins)
+	case v < 0:
+		s.negative.add(s.index(-float64(v)), 1, s.maxBins)
+	default:
+		s.zeroCount++
+	}
+}
+
+// Values returns one value for each bin values have been counted in, from
+// lowest to highest. Each value stands for every recorded value within the
+// sample's relative accuracy of it.
+func (s *DDSketchSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := []int64{}
+	for i := len(s.negative.counts) - 1; i >= 0; i-- {
+		if s.negative.counts[i] > 0 {
+			values = append(values, -int64(math.Round(s.value(s.negative.offset+i))))
+		}
+	}
+	if s.zeroCount > 0 {
+		values = append(values, 0)
+	}
+	for i, c := range s.positive.counts {
+		if c > 0 {
+			values = append(values, int64(math.Round(s.value(s.positive.offset+i))))
+		}
+	}
+	return values
+}
+
+// Variance returns the variance of the recorded values.
+func (s *DDSketchSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.Variance()
+}
+
+// MarshalBinary encodes the sketch in a compact form that can be decoded by
+// UnmarshalBinary or DecodeSample, for example in another process.
+func (s *DDSketchSample) MarshalBinary() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := make([]byte, 0, 64+len(s.positive.counts)+len(s.negative.counts))
+	b = append(b, sampleKindDDSketch)
+	b = appendFloat64(b, s.relativeAccuracy)
+	b = binary.AppendUvarint(b, uint64(s.maxBins))
+	b = s.stats.appendBinary(b)
+	b = binary.AppendVarint(b, s.zeroCount)
+	b = s.positive.appendBinary(b)
+	b = s.negative.appendBinary(b)
+	return b, nil
+}
+
+// UnmarshalBinary replaces the sketch with one encoded by MarshalBinary. It
+// returns an error wrapping ErrInvalidSampleEncoding if the bins do not fit
+// the configuration of the sketch, or do not add up to its count, minimum and
+// maximum.
+func (s *DDSketchSample) UnmarshalBinary(b []byte) error {
+	d := sampleDecoder{b: b}
+	if kind := d.byte(); kind != sampleKindDDSketch && d.err == nil {
+		return fmt.Errorf("%w: not a DDSketch", ErrInvalidSampleEncoding)
+	}
+	relativeAccuracy := d.float64()
+	maxBins := d.uvarint()
+	stats := d.stats()
+	zeroCount := d.varint()
+	positive, negative := d.ddsketchStore(), d.ddsketchStore()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if !(relativeAccuracy > 0 && relativeAccuracy < 1) || maxBins < 1 || maxBins > maxDDSketchMaxBins {
+		return fmt.Errorf("%w: invalid DDSketch configuration", ErrInvalidSampleEncoding)
+	}
+	decoded := &DDSketchSample{
+		relativeAccuracy: relativeAccuracy,
+		logGamma:         math.Log((1 + relativeAccuracy) / (1 - relativeAccuracy)),
+		maxBins:          int(maxBins),
+		positive:         positive,
+		negative:         negative,
+		zeroCount:        zeroCount,
+		stats:            stats,
+	}
+	if err := decoded.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSampleEncoding, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.relativeAccuracy = decoded.relativeAccuracy
+	s.logGamma = decoded.logGamma
+	s.maxBins = decoded.maxBins
+	s.stats = stats
+	s.zeroCount = zeroCount
+	s.positive, s.negative = positive, negative
+	return nil
+}
+
+// validate checks that the bins of a decoded sketch are within its maximum
+// number of bins and the indexes of int64 values, hold non-negative counts
+// that add up to its count, and are consistent with its minimum and maximum.
+func (s *DDSketchSample) validate() error {
+	maxIndex := s.index(math.MaxInt64)
+	total := s.zeroCount
+	if total < 0 {
+		return fmt.Errorf("negative zero count %d", total)
+	}
+	for _, st := range []ddsketchStore{s.positive, s.negative} {
+		if len(st.counts) > s.maxBins || st.offset < 0 || st.offset > maxIndex-len(st.counts)+1 {
+			return fmt.Errorf("%d bins from index %d out of range", len(st.counts), st.offset)
+		}
+		for _, c := range st.counts {
+			if c < 0 || c > math.MaxInt64-total {
+				return fmt.Errorf("invalid bin count %d", c)
+			}
+			total += c
+		}
+	}
+	if total != s.stats.count {
+		return fmt.Errorf("bins count %d values, not %d", total, s.stats.count)
+	}
+	if 0 == total {
+		return nil
+	}
+
+	// The bin furthest from zero of each sign holds the value furthest from
+	// zero exactly, while the bins closest to zero may have been collapsed
+	// into the lowest one that is kept.
+	lowest, highest := s.positive.nonEmpty()
+	negativeLowest, negativeHighest := s.negative.nonEmpty()
+	min, max := s.stats.min, s.stats.max
+	switch {
+	case highest >= 0:
+		if max <= 0 || s.index(float64(max)) != highest {
+			return fmt.Errorf("maximum %d is not in the highest bin", max)
+		}
+	case s.zeroCount > 0:
+		if max != 0 {
+			return fmt.Errorf("maximum %d of zeros and negative values", max)
+		}
+	default:
+		if max >= 0 || s.index(-float64(max)) > negativeLowest {
+			return fmt.Errorf("maximum %d is not in the bins", max)
+		}
+	}
+	switch {
+	case negativeHighest >= 0:
+		if min >= 0 || s.index(-float64(min)) != negativeHighest {
+			return fmt.Errorf("minimum %d is not in the highest negative bin", min)
+		}
+	case s.zeroCount > 0:
+		if min != 0 {
+			return fmt.Errorf("minimum %d of zeros and positive values", min)
+		}
+	default:
+		if min <= 0 || s.index(float64(min)) > lowest {
+			return fmt.Errorf("minimum %d is not in the bins", min)
+		}
+	}
+	n, sum := float64(total), float64(s.stats.sum)
+	if lo, hi := n*float64(min), n*float64(max); sum < lo-math.Abs(lo)*1e-9 || sum > hi+math.Abs(hi)*1e-9 {
+		return fmt.Errorf("sum %d out of the range of the values", s.stats.sum)
+	}
+	if math.IsNaN(s.stats.mean) || !(s.stats.m2 >= 0) {
+		return fmt.Errorf("invalid mean %v or variance %v", s.stats.mean, s.stats.m2)
+	}
+	return nil
+}
+
+// index returns the index of the bin counting the positive value v.
+func (s *DDSketchSample) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value returns the value within the relative accuracy of every value
+// counted in the bin of the given index.
+func (s *DDSketchSample) value(index int) float64 {
+	return 2 * math.Exp(float64(index)*s.logGamma) / (1 + math.Exp(s.logGamma))
+}
+
+// quantile returns the value of the bin holding the value of rank
+// p*(count-1), bounded by the exact minimum and maximum.
+func (s *DDSketchSample) quantile(p float64) float64 {
+	if p <= 0 {
+		return float64(s.stats.min)
+	}
+	if p >= 1 {
+		return float64(s.stats.max)
+	}
+	rank := p * float64(s.stats.count-1)
+	var v float64
+	var cumulative float64
+	found := false
+	for i := len(s.negative.counts) - 1; i >= 0 && !found; i-- {
+		cumulative += float64(s.negative.counts[i])
+		if cumulative > rank {
+			v, found = -s.value(s.negative.offset+i), true
+		}
+	}
+	if !found {
+		cumulative += float64(s.zeroCount)
+		if cumulative > rank {
+			v, found = 0, true
+		}
+	}
+	for i := 0; i < len(s.positive.counts) && !found; i++ {
+		cumulative += float64(s.positive.counts[i])
+		if cumulative > rank {
+			v, found = s.value(s.positive.offset+i), true
+		}
+	}
+	if !found {
+		return float64(s.stats.max)
+	}
+	return math.Max(float64(s.stats.min), math.Min(v, float64(s.stats.max)))
+}
+
+// add counts values in the bin of the given index. When the bins would span
+// more than maxBins indexes, the lowest bins are collapsed into the lowest
+// bin that is kept.
+func (st *ddsketchStore) add(index int, count int64, maxBins int) {
+	if 0 == len(st.counts) {
+		st.offset = index
+		st.counts = append(st.counts, count)
+		return
+	}
+	if highest := st.offset + len(st.counts) - 1; index > highest {
+		// Collapse the bins below the highest maxBins into the lowest kept
+		// before growing, so that a far index never allocates more bins.
+		offset := max(st.offset, index-maxBins+1)
+		counts := make([]int64, index-offset+1)
+		for i, c := range st.counts {
+			counts[max(st.offset+i-offset, 0)] += c
+		}
+		st.counts, st.offset = counts, offset
+	} else if index < st.offset {
+		lowest := st.offset + len(st.counts) - maxBins
+		if index < lowest {
+			index = lowest
+		}
+		if index < st.offset {
+			grown := make([]int64, st.offset-index, st.offset-index+len(st.counts))
+			st.counts = append(grown, st.counts...)
+			st.offset = index
+		}
+	}
+	st.counts[index-st.offset] += count
+}
+
+func (st *ddsketchStore) copy() ddsketchStore {
+	counts := make([]int64, len(st.counts))
+	copy(counts, st.counts)
+	return ddsketchStore{offset: st.offset, counts: counts}
+}
+
+func (st *ddsketchStore) size() int {
+	size := 0
+	for _, c := range st.counts {
+		if c > 0 {
+			size++
+		}
+	}
+	return size
+}
+
+// nonEmpty returns the lowest and highest indexes of the bins holding values,
+// or -1 for both if there are none.
+func (st *ddsketchStore) nonEmpty() (lowest, highest int) {
+	lowest, highest = -1, -1
+	for i, c := range st.counts {
+		if c > 0 {
+			if lowest < 0 {
+				lowest = st.offset + i
+			}
+			highest = st.offset + i
+		}
+	}
+	return lowest, highest
+}
+
+func (st *ddsketchStore) appendBinary(b []byte) []byte {
+	b = binary.AppendVarint(b, int64(st.offset))
+	b = binary.AppendUvarint(b, uint64(len(st.counts)))
+	for _, c := range st.counts {
+		b = binary.AppendVarint(b, c)
+	}
+	return b
+}
+
+func (d *sampleDecoder) ddsketchStore() ddsketchStore {
+	offset := int(d.varint())
+	n := d.length(1)
+	if 0 == n {
+		return ddsketchStore{}
+	}
+	counts := make([]int64, n)
+	for i := range counts {
+		counts[i] = d.varint()
+	}
+	return ddsketchStore{offset: offset, counts: counts}
+}
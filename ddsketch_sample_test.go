@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func BenchmarkDDSketchSample(b *testing.B) {
+	benchmarkSample(b, NewDDSketchSample(0.01))
+}
+
+// testDDSketchPercentiles checks that every percentile of the sample is
+// within the relative accuracy of the exact percentile of the values.
+func testDDSketchPercentiles(t *testing.T, s Sample, values []int64, relativeAccuracy float64) {
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ps := []float64{0, 0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1}
+	scores := s.Percentiles(ps)
+	for i, p := range ps {
+		exact := float64(sorted[int(p*float64(len(sorted)-1))])
+		if err := math.Abs(scores[i] - exact); err > relativeAccuracy*math.Abs(exact)+1e-9 {
+			t.Errorf("%v percentile: %v != %v (error %v)\n", p, scores[i], exact, err/math.Abs(exact))
+		}
+	}
+	if count := s.Count(); int64(len(values)) != count {
+		t.Errorf("s.Count(): %v != %v\n", len(values), count)
+	}
+	if sum := s.Sum(); SampleSum(values) != sum {
+		t.Errorf("s.Sum(): %v != %v\n", SampleSum(values), sum)
+	}
+}
+
+// payloadSizes returns sizes spanning bytes to gigabytes.
+func payloadSizes(n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = int64(math.Pow(10, rand.Float64()*10))
+	}
+	return values
+}
+
+func TestDDSketchSample(t *testing.T) {
+	for _, relativeAccuracy := range []float64{0.05, 0.01, 0.005} {
+		s := NewDDSketchSample(relativeAccuracy)
+		values := payloadSizes(100000)
+		for _, v := range values {
+			s.Update(v)
+		}
+		testDDSketchPercentiles(t, s, values, relativeAccuracy)
+	}
+}
+
+func TestDDSketchSampleNegative(t *testing.T) {
+	s := NewDDSketchSample(0.01)
+	values := payloadSizes(50000)
+	for i := range values {
+		if i%3 == 0 {
+			values[i] = -values[i]
+		} else if i%101 == 0 {
+			values[i] = 0
+		}
+		s.Update(values[i])
+	}
+	testDDSketchPercentiles(t, s, values, 0.01)
+	if min := s.Min(); min >= 0 {
+		t.Errorf("s.Min(): %v >= 0\n", min)
+	}
+	values = s.Values()
+	if !sort.SliceIsSorted(values, func(i, j int) bool { return values[i] < values[j] }) {
+		t.Errorf("s.Values() are not sorted\n")
+	}
+	if size := s.Size(); len(values) != size {
+		t.Errorf("s.Size(): %v != %v\n", len(values), size)
+	}
+}
+
+func TestDDSketchSampleCollapsing(t *testing.T) {
+	s := NewCollapsingDDSketchSample(0.01, 100)
+	values := payloadSizes(10000)
+	for _, v := range values {
+		s.Update(v)
+		s.Update(-v)
+	}
+	if size := s.Size(); size > 200 {
+		t.Errorf("s.Size(): %v > 200\n", size)
+	}
+	// Only the values closest to zero lose accuracy.
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, p := range []float64{0.99, 0.999} {
+		exact := float64(values[int(p*float64(len(values)-1))])
+		if score := s.Percentile(0.5 + p/2); math.Abs(score-exact) > 0.01*exact {
+			t.Errorf("%v percentile: %v != %v\n", 0.5+p/2, score, exact)
+		}
+	}
+	if max := s.Max(); values[len(values)-1] != max {
+		t.Errorf("s.Max(): %v != %v\n", values[len(values)-1], max)
+	}
+}
+
+func TestDDSketchSampleCollapsingFarValues(t *testing.T) {
+	// The bins of values this far apart at this accuracy would not fit in
+	// memory if the sketch grew before collapsing.
+	s := NewCollapsingDDSketchSample(1e-9, 8)
+	s.Update(1)
+	s.Update(math.MaxInt64)
+	if size := s.Size(); 2 != size {
+		t.Errorf("s.Size(): 2 != %v\n", size)
+	}
+	if p := s.Percentile(1); math.Abs(p-math.MaxInt64) > 1e-8*math.MaxInt64 {
+		t.Errorf("s.Percentile(1): %v != %v\n", float64(math.MaxInt64), p)
+	}
+}
+
+func TestDDSketchSampleEmpty(t *testing.T) {
+	s := NewDDSketchSample(0.01)
+	if p := s.Percentile(0.5); 0 != p {
+		t.Errorf("s.Percentile(0.5): 0 != %v\n", p)
+	}
+	s.Update(7)
+	s.Clear()
+	if count, size := s.Count(), s.Size(); 0 != count || 0 != size {
+		t.Errorf("s.Count(), s.Size() after clear: %v, %v\n", count, size)
+	}
+}
+
+func TestDDSketchSampleMerge(t *testing.T) {
+	merged := NewDDSketchSample(0.01).(MergeableSample)
+	var all []int64
+	for i := 0; i < 4; i++ {
+		s := NewDDSketchSample(0.01)
+		values := payloadSizes(25000)
+		for j := range values {
+			if j%2 == 0 {
+				values[j] = -values[j]
+			}
+			s.Update(values[j])
+		}
+		all = append(all, values...)
+		if err := merged.Merge(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testDDSketchPercentiles(t, merged, all, 0.01)
+}
+
+func TestDDSketchSampleMergeIncompatible(t *testing.T) {
+	s := NewDDSketchSample(0.01).(MergeableSample)
+	if err := s.Merge(NewDDSketchSample(0.02)); !errors.Is(err, ErrIncompatibleSample) {
+		t.Errorf("s.Merge(0.02): %v", err)
+	}
+	if err := s.Merge(NewTDigestSample(DefaultTDigestCompression)); !errors.Is(err, ErrIncompatibleSample) {
+		t.Errorf("s.Merge(TDigestSample): %v", err)
+	}
+	if err := s.Merge(s); !errors.Is(err, ErrIncompatibleSample) {
+		t.Errorf("s.Merge(s): %v", err)
+	}
+}
+
+func TestDDSketchSampleEncoding(t *testing.T) {
+	s := NewDDSketchSample(0.01)
+	values := payloadSizes(10000)
+	for i, v := range values {
+		if i%4 == 0 {
+			values[i] = -v
+		}
+		s.Update(values[i])
+	}
+	b, err := s.(MergeableSample).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeSample(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDDSketchPercentiles(t, decoded, values, 0.01)
+	if p, d := s.Percentile(0.99), decoded.Percentile(0.99); p != d {
+		t.Errorf("decoded.Percentile(0.99): %v != %v\n", p, d)
+	}
+
+	for _, invalid := range [][]byte{b[:len(b)-1], append(b, 0)} {
+		if _, err := DecodeSample(invalid); !errors.Is(err, ErrInvalidSampleEncoding) {
+			t.Errorf("DecodeSample(%v...): %v\n", invalid[:4], err)
+		}
+	}
+}
+
+func TestDDSketchSampleDecodeCorrupt(t *testing.T) {
+	for name, corrupt := range map[string]func(s *DDSketchSample){
+		"too many bins":          func(s *DDSketchSample) { s.maxBins = 1 << 40 },
+		"more bins than maximum": func(s *DDSketchSample) { s.maxBins = len(s.positive.counts) - 1 },
+		"negative bin count": func(s *DDSketchSample) {
+			s.positive.counts[0], s.positive.counts[1] = -1, s.positive.counts[1]+s.positive.counts[0]+1
+		},
+		"negative zero count": func(s *DDSketchSample) { s.zeroCount = -1; s.negative.counts[0] += 1 },
+		"count mismatch":      func(s *DDSketchSample) { s.stats.count++ },
+		"offset out of range": func(s *DDSketchSample) { s.positive.offset = 1 << 40 },
+		"negative offset":     func(s *DDSketchSample) { s.negative.offset = -1 },
+		"maximum mismatch":    func(s *DDSketchSample) { s.stats.max *= 2 },
+		"minimum mismatch":    func(s *DDSketchSample) { s.stats.min = 0 },
+		"sum mismatch":        func(s *DDSketchSample) { s.stats.sum = 2 * s.stats.count * s.stats.max },
+	} {
+		s := NewDDSketchSample(0.01).(*DDSketchSample)
+		for i, v := range payloadSizes(1000) {
+			if i%4 == 0 {
+				v = -v
+			}
+			s.Update(v)
+		}
+		corrupt(s)
+		b, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeSample(b); !errors.Is(err, ErrInvalidSampleEncoding) {
+			t.Errorf("DecodeSample() with %s: %v\n", name, err)
+		}
+	}
+}
+
+func TestDDSketchSampleInvalid(t *testing.T) {
+	for _, relativeAccuracy := range []float64{0, 1, -0.5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewDDSketchSample(%v) did not panic\n", relativeAccuracy)
+				}
+			}()
+			NewDDSketchSample(relativeAccuracy)
+		}()
+	}
+	for _, maxBins := range []int{0, 1<<20 + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewCollapsingDDSketchSample(0.01, %v) did not panic\n", maxBins)
+				}
+			}()
+			NewCollapsingDDSketchSample(0.01, maxBins)
+		}()
+	}
+}
+
+func TestHistogramDDSketchSample(t *testing.T) {
+	h := NewHistogram(NewDDSketchSample(0.01))
+	for i := 1; i <= 10000; i++ {
+		h.Update(int64(i))
+	}
+	if p := h.Percentile(0.5); math.Abs(p-5000) > 50 {
+		t.Errorf("h.Percentile(0.5): 5000 != %v\n", p)
+	}
+	if count := h.Count(); 10000 != count {
+		t.Errorf("h.Count(): 10000 != %v\n", count)
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ewmaTickInterval is the interval at which EWMAs are expected to be ticked.
+const ewmaTickInterval = 5 * time.Second
+
+// EWMAs continuously calculate an exponentially-weighted moving average
+// based on an outside source of clock ticks.
+type EWMA interface {
+	Rate() float64  // Moving average rate of events per second
+	Snapshot() EWMA // Save a snapshot of the current rate
+	Tick()          // Fold the events seen since the last tick into the rate
+	Update(int64)   // Record n new events
+}
+
+// NewEWMA constructs a new EWMA with the given alpha.
+func NewEWMA(alpha float64) EWMA {
+	return &StandardEWMA{alpha: alpha}
+}
+
+// NewEWMA1 constructs a new EWMA for a one-minute moving average.
+func NewEWMA1() EWMA {
+	return NewEWMA(ewmaAlpha(time.Minute))
+}
+
+// NewEWMA5 constructs a new EWMA for a five-minute moving average.
+func NewEWMA5() EWMA {
+	return NewEWMA(ewmaAlpha(5 * time.Minute))
+}
+
+// NewEWMA15 constructs a new EWMA for a fifteen-minute moving average.
+func NewEWMA15() EWMA {
+	return NewEWMA(ewmaAlpha(15 * time.Minute))
+}
+
+// ewmaAlpha returns the smoothing factor of an EWMA ticked every
+// ewmaTickInterval that averages over the given window.
+func ewmaAlpha(window time.Duration) float64 {
+	return 1 - math.Exp(-ewmaTickInterval.Seconds()/window.Seconds())
+}
+
+// EWMASnapshot is a read-only copy of another EWMA.
+type EWMASnapshot float64
+
+// Rate returns the rate of events per second at the time the snapshot was
+// taken.
+func (a EWMASnapshot) Rate() float64 { return float64(a) }
+
+// Snapshot returns the snapshot.
+func (a EWMASnapshot) Snapshot() EWMA { return a }
+
+// Tick panics.
+func (EWMASnapshot) Tick() {
+	panic("Tick called on an EWMASnapshot")
+}
+
+// Update panics.
+func (EWMASnapshot) Update(int64) {
+	panic("Update called on an EWMASnapshot")
+}
+
+// StandardEWMA is the standard implementation of an EWMA and tracks the number
+// of uncounted events and processes them on each tick.  It uses the
+// sync/atomic package to manage uncounted events.
+type StandardEWMA struct {
+	uncounted int64
+	alpha     float64
+	rate      uint64
+	init      bool
+	mutex     sync.Mutex
+}
+
+// Rate returns the moving average rate of events per second.
+func (a *StandardEWMA) Rate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&a.rate))
+}
+
+// Snapshot returns a read-only copy of the EWMA.
+func (a *StandardEWMA) Snapshot() EWMA {
+	return EWMASnapshot(a.Rate())
+}
+
+// Tick ticks the clock to update the moving average.  It assumes it is called
+// every five seconds.
+func (a *StandardEWMA) Tick() {
+	count := atomic.SwapInt64(&a.uncounted, 0)
+	instantRate := float64(count) / ewmaTickInterval.Seconds()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	rate := instantRate
+	if a.init {
+		rate = math.Float64frombits(atomic.LoadUint64(&a.rate))
+		rate += a.alpha * (instantRate - rate)
+	}
+	a.init = true
+	atomic.StoreUint64(&a.rate, math.Float64bits(rate))
+}
+
+// Update adds n uncounted events.
+func (a *StandardEWMA) Update(n int64) {
+	atomic.AddInt64(&a.uncounted, n)
+}
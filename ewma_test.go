@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func BenchmarkEWMA(b *testing.B) {
+	a := NewEWMA1()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Update(1)
+		a.Tick()
+	}
+}
+
+func elapseMinute(a EWMA) {
+	for i := 0; i < 12; i++ {
+		a.Tick()
+	}
+}
+
+func testEWMA(t *testing.T, a EWMA, minutes float64) {
+	a.Update(3)
+	a.Tick()
+	if rate := a.Rate(); 0.6 != rate {
+		t.Errorf("initial a.Rate(): 0.6 != %v\n", rate)
+	}
+	for i := 1; i <= 5; i++ {
+		elapseMinute(a)
+		expected := 0.6 * math.Exp(-float64(i)/minutes)
+		if rate := a.Rate(); math.Abs(expected-rate) > 1e-9 {
+			t.Errorf("%d minute a.Rate(): %v != %v\n", i, expected, rate)
+		}
+	}
+}
+
+func TestEWMA1(t *testing.T) {
+	testEWMA(t, NewEWMA1(), 1)
+}
+
+func TestEWMA5(t *testing.T) {
+	testEWMA(t, NewEWMA5(), 5)
+}
+
+func TestEWMA15(t *testing.T) {
+	testEWMA(t, NewEWMA15(), 15)
+}
+
+func TestEWMASnapshot(t *testing.T) {
+	a := NewEWMA1()
+	a.Update(5)
+	a.Tick()
+	snapshot := a.Snapshot()
+	elapseMinute(a)
+	if rate := snapshot.Rate(); 1.0 != rate {
+		t.Errorf("snapshot.Rate(): 1.0 != %v\n", rate)
+	}
+}
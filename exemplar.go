@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// MaxExemplarLabelLength is the combined length, in characters, of the names
+// and values of the labels of an exemplar at most. An exemplar with longer
+// labels is not recorded.
+const MaxExemplarLabelLength = 128
+
+// Exemplars are values recorded with labels, such as a trace ID, that
+// identify an example of the events a metric counts. OpenMetrics output
+// carries the most recent exemplar of a counter and of each bucket of a
+// bucketed histogram.
+type Exemplar struct {
+	Labels    Labels
+	Value     float64
+	Timestamp time.Time
+}
+
+// ExemplarCounters are Counters that record an exemplar of their increments.
+// The counters constructed by NewCounter and the children of a CounterVec
+// implement it.
+type ExemplarCounter interface {
+	Counter
+	Exemplar() *Exemplar           // The most recent exemplar, or nil if none is recorded
+	IncWithExemplar(int64, Labels) // Increment the counter and record the increment as its exemplar
+}
+
+// newExemplar returns an exemplar of the value with a copy of the labels, or
+// nil if the labels are longer than MaxExemplarLabelLength.
+func newExemplar(now time.Time, v float64, labels Labels) *Exemplar {
+	length := 0
+	copied := make(Labels, len(labels))
+	for name, value := range labels {
+		length += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+		copied[name] = value
+	}
+	if length > MaxExemplarLabelLength {
+		return nil
+	}
+	return &Exemplar{Labels: copied, Value: v, Timestamp: now}
+}
+
+// creationTimer is implemented by the metrics that know when they were
+// created, or last cleared, which OpenMetrics outputs as _created samples.
+type creationTimer interface {
+	createdTime() time.Time
+}
+
+// createdTime returns the time a metric was created, or the zero time if the
+// metric does not record it.
+func createdTime(i interface{}) time.Time {
+	if c, ok := i.(creationTimer); ok {
+		return c.createdTime()
+	}
+	return time.Time{}
+}
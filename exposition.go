@@ -0,0 +1,408 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of metric family output by the text exposition formats.
+const (
+	familyCounter   = "counter"
+	familyGauge     = "gauge"
+	familyHistogram = "histogram"
+	familySummary   = "summary"
+	familyInfo      = "info"
+	familyUnknown   = "unknown"
+)
+
+// familySuffixes are the suffixes of the samples output by each kind of
+// family, including the _created samples of OpenMetrics.
+var familySuffixes = map[string][]string{
+	familyCounter:   {"_total", "_created"},
+	familyGauge:     {""},
+	familyHistogram: {"_bucket", "_sum", "_count", "_created"},
+	familySummary:   {"", "_sum", "_count", "_created"},
+	familyInfo:      {"_info"},
+	familyUnknown:   {""},
+}
+
+// metricFamily is a set of series that share a name and kind, such as every
+// child of a CounterVec, as output by the text exposition formats.
+type metricFamily struct {
+	name   string // sanitized name, without the suffixes of its samples
+	kind   string
+	unit   string // base unit of the values, such as "seconds", if any
+	series []*metricSeries
+}
+
+// metricSeries is the samples of a single metric of a family, such as the
+// buckets, sum and count of a histogram.
+type metricSeries struct {
+	labels  []labelPair
+	samples []metricSample
+	created time.Time // when the metric was created or cleared, if known
+}
+
+// metricSample is a single line of the text exposition formats.
+type metricSample struct {
+	suffix   string      // appended to the name of the family, such as "_sum"
+	labels   []labelPair // added to the labels of the series, such as le
+	value    float64
+	exemplar *Exemplar
+}
+
+type labelPair struct {
+	name, value string
+}
+
+// reservedLabelNames are the labels the exposition formats add to series
+// themselves: the index of a registry in a Slice, the bound of a bucket and
+// the quantile of a summary. Metric vectors cannot use them.
+var reservedLabelNames = map[string]bool{"index": true, "le": true, "quantile": true}
+
+// metricFamilies walks a registry and returns the families of its metrics,
+// sorted by name, with the series of each family sorted by label values.
+// Nested registries and slices are flattened into the names of their metrics,
+// and the registries of a slice are told apart by an index label. A metric
+// whose name is taken by a family of another kind, whose samples would share
+// a name with those of another family, or whose labels are taken by another
+// metric of its family, is left out, as are Json metrics, which have no
+// numeric value.
+func metricFamilies(r Registry) []*metricFamily {
+	c := &familyCollector{
+		families: make(map[string]*metricFamily),
+		names:    make(map[string]bool),
+	}
+	c.collectRegistry("", r, nil, defaultExportOptions)
+
+	families := make([]*metricFamily, 0, len(c.families))
+	for _, family := range c.families {
+		sort.SliceStable(family.series, func(i, j int) bool {
+			return lessLabels(family.series[i].labels, family.series[j].labels)
+		})
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+	return families
+}
+
+// familyCollector gathers the families of the metrics of a registry by name.
+type familyCollector struct {
+	families map[string]*metricFamily
+	names    map[string]bool // names of the families and of their samples
+}
+
+// collectRegistry collects the metrics of a registry in order of name, so
+// the metric that keeps a name shared by metrics of different kinds, or whose
+// names are the same once sanitized, does not depend on the order of Each.
+func (c *familyCollector) collectRegistry(prefix string, r Registry, labels []labelPair, opts exportOptions) {
+	type registered struct {
+		metricKV
+		opts exportOptions
+	}
+	var metrics []registered
+	eachMetric(r, opts, func(name string, i interface{}, opts exportOptions) {
+		metrics = append(metrics, registered{metricKV{name, i}, opts})
+	})
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	for _, m := range metrics {
+		c.collect(prefix+m.name, m.value, labels, m.opts)
+	}
+}
+
+func (c *familyCollector) collect(name string, i interface{}, labels []labelPair, opts exportOptions) {
+	switch metric := i.(type) {
+	case Counter:
+		// A counter decremented below zero is output as 0, as the counters of
+		// the exposition formats cannot be negative.
+		sample := metricSample{suffix: "_total", value: float64(max(metric.Count(), 0))}
+		if e, ok := metric.(ExemplarCounter); ok {
+			sample.exemplar = e.Exemplar()
+		}
+		c.add(name, familyCounter, "", labels, createdTime(metric), sample)
+	case Gauge:
+		if v, ok := recoverValue(func() interface{} { return metric.Value() }).(int64); ok {
+			c.add(name, familyGauge, "", labels, time.Time{}, metricSample{value: float64(v)})
+		}
+	case GaugeFloat64:
+		if v, ok := recoverValue(func() interface{} { return metric.Value() }).(float64); ok {
+			c.add(name, familyGauge, "", labels, time.Time{}, metricSample{value: v})
+		}
+	case Meter:
+		c.collectMeter(name, metric.Snapshot(), labels, createdTime(metric))
+	case Timer:
+		c.collectTimer(name, metric, labels, opts)
+	case Histogram:
+		percentiles := metric.OutputPercentiles()
+		if percentiles == nil {
+			percentiles = opts.percentiles
+		}
+		samples := quantileSamples(percentiles, metric.Percentiles(percentiles))
+		samples = append(samples,
+			metricSample{suffix: "_sum", value: float64(metric.Sum())},
+			metricSample{suffix: "_count", value: float64(metric.Count())})
+		c.add(name, familySummary, "", labels, time.Time{}, samples...)
+	case BucketedHistogram:
+		c.collectBucketedHistogram(name, metric.Snapshot(), labels, createdTime(metric))
+	case Summary:
+		objectives := metric.Objectives()
+		quantiles := make([]float64, len(objectives))
+		for i, o := range objectives {
+			quantiles[i] = o.Quantile
+		}
+		samples := quantileSamples(quantiles, metric.Quantiles(quantiles))
+		samples = append(samples,
+			metricSample{suffix: "_sum", value: metric.Sum()},
+			metricSample{suffix: "_count", value: float64(metric.Count())})
+		c.add(name, familySummary, "", labels, createdTime(metric), samples...)
+	case MetricVec:
+		labelNames := metric.LabelNames()
+		metric.EachChild(func(labelValues []string, child interface{}) {
+			childLabels := append([]labelPair{}, labels...)
+			for i, labelName := range labelNames {
+				childLabels = append(childLabels, labelPair{sanitizeName(labelName), labelValues[i]})
+			}
+			c.collect(name, child, childLabels, opts)
+		})
+	case Text:
+		c.add(name, familyInfo, "", labels, time.Time{}, metricSample{
+			suffix: "_info",
+			labels: []labelPair{{"value", metric.Text()}},
+			value:  1,
+		})
+	case Slice:
+		for index, r := range metric.GetAll() {
+			indexLabels := append(append([]labelPair{}, labels...), labelPair{"index", strconv.Itoa(index)})
+			c.collectRegistry(name+"_", r, indexLabels, opts)
+		}
+	case Json:
+		// Json metrics have no numeric value to output.
+	case Registry:
+		c.collectRegistry(name+"_", metric, labels, opts)
+	case MetricMarshaler:
+		if v, ok := numericValue(marshalMetric(metric)); ok {
+			c.add(name, familyUnknown, "", labels, time.Time{}, metricSample{value: v})
+		}
+	}
+}
+
+// collectMeter adds the count of a meter as a counter and its mean and rates
+// as gauges, named after the values output by GetAllJson. The gauges are left
+// out along with the count.
+func (c *familyCollector) collectMeter(name string, m Meter, labels []labelPair, created time.Time) {
+	if !c.add(name, familyCounter, "", labels, created, metricSample{suffix: "_total", value: float64(m.Count())}) {
+		return
+	}
+	c.add(name+"_mean", familyGauge, "", labels, time.Time{}, metricSample{value: m.RateMean()})
+	c.add(name+"_last_value", familyGauge, "", labels, time.Time{}, metricSample{value: float64(m.LastValue())})
+	c.add(name+"_rate", familyGauge, "", labels, time.Time{}, metricSample{value: m.Rate()})
+	c.add(name+"_rate1", familyGauge, "", labels, time.Time{}, metricSample{value: m.Rate1()})
+	c.add(name+"_rate5", familyGauge, "", labels, time.Time{}, metricSample{value: m.Rate5()})
+	c.add(name+"_rate15", familyGauge, "", labels, time.Time{}, metricSample{value: m.Rate15()})
+}
+
+// collectTimer adds a timer as a summary in seconds, the base unit of time of
+// the exposition formats, whatever the unit of the timer or registry.
+func (c *familyCollector) collectTimer(name string, t Timer, labels []labelPair, opts exportOptions) {
+	ps := t.Percentiles(opts.percentiles)
+	quantiles := make([]float64, len(ps))
+	for i, d := range ps {
+		quantiles[i] = d.Seconds()
+	}
+	samples := quantileSamples(opts.percentiles, quantiles)
+	samples = append(samples,
+		metricSample{suffix: "_sum", value: t.Sum().Seconds()},
+		metricSample{suffix: "_count", value: float64(t.Count())})
+	c.add(name, familySummary, "seconds", labels, createdTime(t), samples...)
+}
+
+// collectBucketedHistogram adds a histogram with its cumulative bucket
+// counts.
+func (c *familyCollector) collectBucketedHistogram(name string, h BucketedHistogram, labels []labelPair, created time.Time) {
+	bounds, counts, exemplars := h.Bounds(), h.BucketCounts(), h.Exemplars()
+	samples := make([]metricSample, 0, len(counts)+2)
+	var cumulative int64
+	for i, count := range counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(bounds) {
+			le = formatFloat(bounds[i])
+		}
+		sample := metricSample{
+			suffix: "_bucket",
+			labels: []labelPair{{"le", le}},
+			value:  float64(cumulative),
+		}
+		if i < len(exemplars) {
+			sample.exemplar = exemplars[i]
+		}
+		samples = append(samples, sample)
+	}
+	samples = append(samples,
+		metricSample{suffix: "_sum", value: h.Sum()},
+		metricSample{suffix: "_count", value: float64(h.Count())})
+	c.add(name, familyHistogram, "", labels, created, samples...)
+}
+
+// add adds a series to the family of the given name, creating the family if
+// it does not exist, and returns whether it was added. The series is left out
+// if the family is of another kind or unit, or already has a series with the
+// same labels, and a family is not created if its name or the names of its
+// samples are taken by another family, so a gauge "batch_count" does not
+// output the same sample as the count of a histogram "batch". Names with a
+// unit are suffixed with the unit, and counters and info metrics lose the
+// suffix of their samples, so "requests_total" is not output as
+// "requests_total_total".
+func (c *familyCollector) add(name, kind, unit string, labels []labelPair, created time.Time, samples ...metricSample) bool {
+	name = sanitizeName(name)
+	switch kind {
+	case familyCounter:
+		name = strings.TrimSuffix(name, "_total")
+	case familyInfo:
+		name = strings.TrimSuffix(name, "_info")
+	}
+	if unit != "" && !strings.HasSuffix(name, "_"+unit) {
+		name += "_" + unit
+	}
+	family, ok := c.families[name]
+	if !ok {
+		names := []string{name}
+		for _, suffix := range familySuffixes[kind] {
+			names = append(names, name+suffix)
+		}
+		for _, n := range names {
+			if c.names[n] {
+				return false
+			}
+		}
+		for _, n := range names {
+			c.names[n] = true
+		}
+		family = &metricFamily{name: name, kind: kind, unit: unit}
+		c.families[name] = family
+	} else if family.kind != kind || family.unit != unit {
+		return false
+	}
+	for _, series := range family.series {
+		if equalLabels(series.labels, labels) {
+			return false
+		}
+	}
+	family.series = append(family.series, &metricSeries{labels: labels, samples: samples, created: created})
+	return true
+}
+
+// quantileSamples returns the samples of the given quantiles of a summary.
+func quantileSamples(quantiles, values []float64) []metricSample {
+	samples := make([]metricSample, len(quantiles))
+	for i, q := range quantiles {
+		samples[i] = metricSample{
+			labels: []labelPair{{"quantile", formatFloat(q)}},
+			value:  values[i],
+		}
+	}
+	return samples
+}
+
+// numericValue returns the value of a number output by a MetricMarshaler.
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// lessLabels orders label sets by their values, then by their length.
+func lessLabels(a, b []labelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].name != b[i].name {
+			return a[i].name < b[i].name
+		}
+		if a[i].value != b[i].value {
+			return a[i].value < b[i].value
+		}
+	}
+	return len(a) < len(b)
+}
+
+// equalLabels returns whether two label sets are the same.
+func equalLabels(a, b []labelPair) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeName returns a metric or label name with every character other
+// than an ASCII letter, digit or underscore, such as the dots of
+// "http.requests", replaced with an underscore, and prefixed with an
+// underscore if it is empty or starts with a digit.
+func sanitizeName(name string) string {
+	b := []byte(name)
+	for i, ch := range b {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || '0' <= b[0] && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// formatFloat returns a sample value or label value such as le in the form
+// used by the exposition formats. Whole numbers are written without an
+// exponent, so a count of 1000000 is not written as 1e+06.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatTimestamp returns a timestamp in the form used by OpenMetrics, in
+// seconds since the Unix epoch. The fraction is formatted from the
+// nanoseconds rather than as a float64, which cannot hold them exactly.
+func formatTimestamp(t time.Time) string {
+	s := strconv.FormatInt(t.Unix(), 10)
+	if ns := t.Nanosecond(); ns != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", ns), "0")
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// connectionCount is a metric defined outside of the package that outputs a
+// plain number.
+type connectionCount int
+
+func (c connectionCount) MarshalMetric() (interface{}, error) { return int(c), nil }
+
+func TestSanitizeName(t *testing.T) {
+	for name, want := range map[string]string{
+		"requests":        "requests",
+		"http.requests":   "http_requests",
+		"db:query-time":   "db_query_time",
+		"2xx":             "_2xx",
+		"":                "_",
+		"caché":           "cach__",
+		"__overflow__":    "__overflow__",
+		"Mixed_Case_2019": "Mixed_Case_2019",
+	} {
+		if sanitized := sanitizeName(name); want != sanitized {
+			t.Errorf("sanitizeName(%q): %q != %q\n", name, want, sanitized)
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	for v, want := range map[float64]string{
+		0:            "0",
+		1000000:      "1000000",
+		-2.5:         "-2.5",
+		0.001:        "0.001",
+		1e20:         "1e+20",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+	} {
+		if s := formatFloat(v); want != s {
+			t.Errorf("formatFloat(%v): %q != %q\n", v, want, s)
+		}
+	}
+	if s := formatFloat(math.NaN()); "NaN" != s {
+		t.Errorf("formatFloat(NaN): \"NaN\" != %q\n", s)
+	}
+}
+
+func TestMetricFamiliesNestedImplementation(t *testing.T) {
+	inner := NewRegistry()
+	NewRegisteredCounter("hits", inner).Inc(47)
+	inner.Register("connections", connectionCount(3))
+	inner.Register("breaker", &breakerState{state: "open"})
+	r := NewRegistry()
+	r.Register("nested", &prefixedRegistry{prefix: "db.", r: inner})
+
+	families := metricFamilies(r)
+	if 2 != len(families) {
+		t.Fatalf("len(metricFamilies()): 2 != %v\n", len(families))
+	}
+	if f := families[0]; "nested_db_connections" != f.name || familyUnknown != f.kind || 3 != f.series[0].samples[0].value {
+		t.Errorf("families[0]: %+v\n", f)
+	}
+	if f := families[1]; "nested_db_hits" != f.name || familyCounter != f.kind || 47 != f.series[0].samples[0].value {
+		t.Errorf("families[1]: %+v\n", f)
+	}
+}
+
+func TestMetricFamiliesPanickingGauge(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredFunctionalGauge("broken", r, func() int64 { panic("unavailable") })
+	NewRegisteredGauge("ok", r).Update(1)
+	if families := metricFamilies(r); 1 != len(families) || "ok" != families[0].name {
+		t.Errorf("metricFamilies(): %+v\n", families)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	for ts, want := range map[time.Time]string{
+		time.Unix(1520879607, 0):         "1520879607",
+		time.Unix(1520879607, 123000000): "1520879607.123",
+		time.Unix(1520879607, 1):         "1520879607.000000001",
+	} {
+		if s := formatTimestamp(ts); want != s {
+			t.Errorf("formatTimestamp(%v): %q != %q\n", ts, want, s)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Gauges hold an int64 value that can be set arbitrarily.
+type Gauge interface {
+	Snapshot() Gauge // Save a snapshot of the current value
+	Update(int64)    // Replace the current value
+	Value() int64    // Get the current value
+}
+
+// NewGauge constructs a new StandardGauge.
+func NewGauge() Gauge {
+	return &StandardGauge{0}
+}
+
+// NewRegisteredGauge constructs and registers a new StandardGauge.
+func NewRegisteredGauge(name string, r Registry) Gauge {
+	c := NewGauge()
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// NewFunctionalGauge constructs a new FunctionalGauge.
+func NewFunctionalGauge(f func() int64) Gauge {
+	return &FunctionalGauge{value: f}
+}
+
+// NewRegisteredFunctionalGauge constructs and registers a new FunctionalGauge.
+func NewRegisteredFunctionalGauge(name string, r Registry, f func() int64) Gauge {
+	c := NewFunctionalGauge(f)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetGauge returns an existing Gauge
+func GetGauge(name string, r Registry) Gauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(Gauge)
+}
+
+// GaugeSnapshot is a read-only copy of another Gauge.
+type GaugeSnapshot int64
+
+// Snapshot returns the snapshot.
+func (g GaugeSnapshot) Snapshot() Gauge { return g }
+
+// Update panics.
+func (GaugeSnapshot) Update(int64) {
+	panic("Update called on a GaugeSnapshot")
+}
+
+// Value returns the value at the time the snapshot was taken.
+func (g GaugeSnapshot) Value() int64 { return int64(g) }
+
+// MarshalMetric returns the value at the time the snapshot was taken.
+func (g GaugeSnapshot) MarshalMetric() (interface{}, error) { return g.Value(), nil }
+
+// StandardGauge is the standard implementation of a Gauge and uses the
+// sync/atomic package to manage a single int64 value.
+type StandardGauge struct {
+	value int64
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *StandardGauge) Snapshot() Gauge {
+	return GaugeSnapshot(g.Value())
+}
+
+// Update updates the gauge's value.
+func (g *StandardGauge) Update(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+// Value returns the gauge's current value.
+func (g *StandardGauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// MarshalMetric returns the gauge's current value, as output by the
+// registry.
+func (g *StandardGauge) MarshalMetric() (interface{}, error) {
+	return g.Value(), nil
+}
+
+// FunctionalGauge returns the value computed by a function each time it is
+// read, so the function is only evaluated when the registry is output.
+type FunctionalGauge struct {
+	value func() int64
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *FunctionalGauge) Snapshot() Gauge { return GaugeSnapshot(g.Value()) }
+
+// Update panics.
+func (*FunctionalGauge) Update(int64) {
+	panic("Update called on a FunctionalGauge")
+}
+
+// Value returns the result of the gauge's function.
+func (g *FunctionalGauge) Value() int64 {
+	return g.value()
+}
+
+// MarshalMetric returns the result of the gauge's function, as output by the
+// registry. A panic inside the function is reported by the registry as the
+// value of the gauge.
+func (g *FunctionalGauge) MarshalMetric() (interface{}, error) {
+	return g.Value(), nil
+}
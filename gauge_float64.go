@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"math"
+	"os"
+	"sync/atomic"
+)
+
+// GaugeFloat64s hold a float64 value that can be set arbitrarily.
+type GaugeFloat64 interface {
+	Snapshot() GaugeFloat64 // Save a snapshot of the current value
+	Update(float64)         // Replace the current value
+	Value() float64         // Get the current value
+}
+
+// NewGaugeFloat64 constructs a new StandardGaugeFloat64.
+func NewGaugeFloat64() GaugeFloat64 {
+	return &StandardGaugeFloat64{0}
+}
+
+// NewRegisteredGaugeFloat64 constructs and registers a new StandardGaugeFloat64.
+func NewRegisteredGaugeFloat64(name string, r Registry) GaugeFloat64 {
+	c := NewGaugeFloat64()
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// NewFunctionalGaugeFloat64 constructs a new FunctionalGaugeFloat64.
+func NewFunctionalGaugeFloat64(f func() float64) GaugeFloat64 {
+	return &FunctionalGaugeFloat64{value: f}
+}
+
+// NewRegisteredFunctionalGaugeFloat64 constructs and registers a new
+// FunctionalGaugeFloat64.
+func NewRegisteredFunctionalGaugeFloat64(name string, r Registry, f func() float64) GaugeFloat64 {
+	c := NewFunctionalGaugeFloat64(f)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetGaugeFloat64 returns an existing GaugeFloat64
+func GetGaugeFloat64(name string, r Registry) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(GaugeFloat64)
+}
+
+// GaugeFloat64Snapshot is a read-only copy of another GaugeFloat64.
+type GaugeFloat64Snapshot float64
+
+// Snapshot returns the snapshot.
+func (g GaugeFloat64Snapshot) Snapshot() GaugeFloat64 { return g }
+
+// Update panics.
+func (GaugeFloat64Snapshot) Update(float64) {
+	panic("Update called on a GaugeFloat64Snapshot")
+}
+
+// Value returns the value at the time the snapshot was taken.
+func (g GaugeFloat64Snapshot) Value() float64 { return float64(g) }
+
+// MarshalMetric returns the value at the time the snapshot was taken.
+func (g GaugeFloat64Snapshot) MarshalMetric() (interface{}, error) {
+	return jsonFloat64(g.Value()), nil
+}
+
+// StandardGaugeFloat64 is the standard implementation of a GaugeFloat64 and
+// stores the bits of its float64 value with the sync/atomic package.
+type StandardGaugeFloat64 struct {
+	value uint64
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *StandardGaugeFloat64) Snapshot() GaugeFloat64 {
+	return GaugeFloat64Snapshot(g.Value())
+}
+
+// Update updates the gauge's value.
+func (g *StandardGaugeFloat64) Update(v float64) {
+	atomic.StoreUint64(&g.value, math.Float64bits(v))
+}
+
+// Value returns the gauge's current value.
+func (g *StandardGaugeFloat64) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.value))
+}
+
+// MarshalMetric returns the gauge's current value, as output by the
+// registry.
+func (g *StandardGaugeFloat64) MarshalMetric() (interface{}, error) {
+	return jsonFloat64(g.Value()), nil
+}
+
+// FunctionalGaugeFloat64 returns the value computed by a function each time
+// it is read, so the function is only evaluated when the registry is output.
+type FunctionalGaugeFloat64 struct {
+	value func() float64
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *FunctionalGaugeFloat64) Snapshot() GaugeFloat64 {
+	return GaugeFloat64Snapshot(g.Value())
+}
+
+// Update panics.
+func (*FunctionalGaugeFloat64) Update(float64) {
+	panic("Update called on a FunctionalGaugeFloat64")
+}
+
+// Value returns the result of the gauge's function.
+func (g *FunctionalGaugeFloat64) Value() float64 {
+	return g.value()
+}
+
+// MarshalMetric returns the result of the gauge's function, as output by the
+// registry. A panic inside the function is reported by the registry as the
+// value of the gauge.
+func (g *FunctionalGaugeFloat64) MarshalMetric() (interface{}, error) {
+	return jsonFloat64(g.Value()), nil
+}
+
+// jsonFloat64 returns the value a float64 is output as by the registry. JSON
+// has no NaN or infinities, so they are output as the strings "NaN", "+Inf"
+// and "-Inf" rather than failing the output of the whole registry.
+func jsonFloat64(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return formatFloat(v)
+	}
+	return v
+}
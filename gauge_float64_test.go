@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func BenchmarkGaugeFloat64(b *testing.B) {
+	g := NewGaugeFloat64()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Update(float64(i))
+	}
+}
+
+func TestGaugeFloat64(t *testing.T) {
+	g := NewGaugeFloat64()
+	g.Update(47.0)
+	if v := g.Value(); 47.0 != v {
+		t.Errorf("g.Value(): 47.0 != %v\n", v)
+	}
+}
+
+func TestGaugeFloat64Snapshot(t *testing.T) {
+	g := NewGaugeFloat64()
+	g.Update(47.0)
+	snapshot := g.Snapshot()
+	g.Update(0)
+	if v := snapshot.Value(); 47.0 != v {
+		t.Errorf("snapshot.Value(): 47.0 != %v\n", v)
+	}
+}
+
+func TestGetGaugeFloat64(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("foo", r).Update(47.25)
+	if g := GetGaugeFloat64("foo", r); 47.25 != g.Value() {
+		t.Fatal(g)
+	}
+}
+
+func TestGaugeFloat64Json(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("foo", r).Update(0.125)
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(js); `{"foo":0.125}` != s {
+		t.Errorf("r.GetAllJson(): %s", s)
+	}
+}
+
+func TestGaugeFloat64JsonNonFinite(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("nan", r).Update(math.NaN())
+	NewRegisteredGaugeFloat64("inf", r).Update(math.Inf(1))
+	NewRegisteredFunctionalGaugeFloat64("-inf", r, func() float64 { return math.Inf(-1) })
+	NewRegisteredGaugeFloat64("ok", r).Update(0.5)
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(js); `{"-inf":"-Inf","inf":"+Inf","nan":"NaN","ok":0.5}` != s {
+		t.Errorf("r.GetAllJson(): %s", s)
+	}
+}
+
+func TestFunctionalGaugeFloat64(t *testing.T) {
+	var counter float64
+	fg := NewFunctionalGaugeFloat64(func() float64 {
+		counter++
+		return counter
+	})
+	fg.Value()
+	fg.Value()
+	if 2 != counter {
+		t.Error("counter != 2")
+	}
+}
+
+func TestGetFunctionalGaugeFloat64(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredFunctionalGaugeFloat64("foo", r, func() float64 { return 47.25 })
+	if g := GetGaugeFloat64("foo", r); 47.25 != g.Value() {
+		t.Fatal(g)
+	}
+}
+
+func TestFunctionalGaugeFloat64Panic(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredFunctionalGaugeFloat64("foo", r, func() float64 { panic("boom") })
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(js); `{"foo":{"error":"panic: boom"}}` != s {
+		t.Errorf("r.GetAllJson(): %s", s)
+	}
+}
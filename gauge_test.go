@@ -0,0 +1,112 @@
+package metrics
+
+import "testing"
+
+func BenchmarkGauge(b *testing.B) {
+	g := NewGauge()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Update(int64(i))
+	}
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge()
+	g.Update(int64(47))
+	if v := g.Value(); 47 != v {
+		t.Errorf("g.Value(): 47 != %v\n", v)
+	}
+}
+
+func TestGaugeSnapshot(t *testing.T) {
+	g := NewGauge()
+	g.Update(int64(47))
+	snapshot := g.Snapshot()
+	g.Update(int64(0))
+	if v := snapshot.Value(); 47 != v {
+		t.Errorf("snapshot.Value(): 47 != %v\n", v)
+	}
+}
+
+func TestGaugeZero(t *testing.T) {
+	g := NewGauge()
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value(): 0 != %v\n", v)
+	}
+}
+
+func TestGetGauge(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("foo", r).Update(47)
+	if g := GetGauge("foo", r); 47 != g.Value() {
+		t.Fatal(g)
+	}
+}
+
+func TestGaugeJson(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("foo", r).Update(47)
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(js); `{"foo":47}` != s {
+		t.Errorf("r.GetAllJson(): %s", s)
+	}
+}
+
+func TestFunctionalGauge(t *testing.T) {
+	var counter int64
+	fg := NewFunctionalGauge(func() int64 {
+		counter++
+		return counter
+	})
+	fg.Value()
+	fg.Value()
+	if 2 != counter {
+		t.Error("counter != 2")
+	}
+}
+
+func TestGetFunctionalGauge(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredFunctionalGauge("foo", r, func() int64 { return 47 })
+	if g := GetGauge("foo", r); 47 != g.Value() {
+		t.Fatal(g)
+	}
+}
+
+func TestFunctionalGaugeJson(t *testing.T) {
+	r := NewRegistry()
+	var calls int
+	NewRegisteredFunctionalGauge("foo", r, func() int64 {
+		calls++
+		return 47
+	})
+	if 0 != calls {
+		t.Fatalf("function evaluated before output: %d calls", calls)
+	}
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(js); `{"foo":47}` != s {
+		t.Errorf("r.GetAllJson(): %s", s)
+	}
+	if 1 != calls {
+		t.Errorf("calls: 1 != %d", calls)
+	}
+}
+
+func TestFunctionalGaugePanic(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredFunctionalGauge("foo", r, func() int64 { panic("boom") })
+	NewRegisteredGauge("bar", r).Update(47)
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(js); `{"bar":47,"foo":{"error":"panic: boom"}}` != s {
+		t.Errorf("r.GetAllJson(): %s", s)
+	}
+}
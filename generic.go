@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// MetricNotFound is the error returned when no metric is registered under a
+// name.
+type MetricNotFound string
+
+func (err MetricNotFound) Error() string {
+	return fmt.Sprintf("metric not found: %s", string(err))
+}
+
+// MetricTypeMismatch is the error returned when the metric registered under a
+// name is not of the type asked for.
+type MetricTypeMismatch struct {
+	Name   string       // Name the metric is registered under
+	Want   reflect.Type // Type asked for
+	Metric interface{}  // Metric registered under the name
+}
+
+func (err *MetricTypeMismatch) Error() string {
+	return fmt.Sprintf("metric %s is a %T, not a %v", err.Name, err.Metric, err.Want)
+}
+
+// GetOrRegister returns the metric of type T registered under the given name
+// in r, or DefaultRegistry if r is nil. If there is none, the metric made by
+// newMetric is registered and returned; newMetric must not use r. When
+// several goroutines register the same name at once, they all get the one
+// metric that was registered, provided r implements GetOrRegisterer; other
+// registries are asked with Get then Register. A metric made by newMetric
+// that could not be registered is stopped. The error is a *MetricTypeMismatch
+// if the registered metric is not a T, or the error of Registry.Register.
+func GetOrRegister[T any](r Registry, name string, newMetric func() T) (T, error) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	var zero T
+	if g, ok := r.(GetOrRegisterer); ok {
+		i, err := g.GetOrRegister(name, func() interface{} { return newMetric() })
+		if err != nil {
+			return zero, err
+		}
+		return as[T](name, i)
+	}
+	if i := r.Get(name); i != nil {
+		return as[T](name, i)
+	}
+	m := newMetric()
+	if err := r.Register(name, m); err != nil {
+		stopMetric(m)
+		if i := r.Get(name); i != nil && errors.As(err, new(DuplicateMetric)) {
+			return as[T](name, i)
+		}
+		return zero, err
+	}
+	return m, nil
+}
+
+// Lookup returns the metric of type T registered under the given name in r,
+// or DefaultRegistry if r is nil. It returns false if there is none or it is
+// not a T.
+func Lookup[T any](r Registry, name string) (T, bool) {
+	m, err := get[T](r, name)
+	return m, err == nil
+}
+
+// MustGet returns the metric of type T registered under the given name in r,
+// or DefaultRegistry if r is nil. It panics with a MetricNotFound or
+// *MetricTypeMismatch error if there is none or it is not a T.
+func MustGet[T any](r Registry, name string) T {
+	m, err := get[T](r, name)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func get[T any](r Registry, name string) (T, error) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	i := r.Get(name)
+	if nil == i {
+		var zero T
+		return zero, MetricNotFound(name)
+	}
+	return as[T](name, i)
+}
+
+// as returns the metric registered under name as a T.
+func as[T any](name string, i interface{}) (T, error) {
+	m, ok := i.(T)
+	if !ok {
+		return m, &MetricTypeMismatch{Name: name, Want: reflect.TypeOf((*T)(nil)).Elem(), Metric: i}
+	}
+	return m, nil
+}
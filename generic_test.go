@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestGetOrRegister(t *testing.T) {
+	r := NewRegistry()
+	c, err := GetOrRegister(r, "foo", NewCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Inc(47)
+	again, err := GetOrRegister(r, "foo", func() Counter {
+		t.Fatal("newMetric called for a registered metric")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := again.Count(); 47 != count {
+		t.Errorf("again.Count(): 47 != %v\n", count)
+	}
+}
+
+func TestGetOrRegisterTypeMismatch(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	_, err := GetOrRegister(r, "foo", NewTimer)
+	var mismatch *MetricTypeMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("GetOrRegister(foo): %v\n", err)
+	}
+	if s := err.Error(); "metric foo is a *metrics.StandardCounter, not a metrics.Timer" != s {
+		t.Errorf("err.Error(): %q\n", s)
+	}
+}
+
+func TestGetOrRegisterCardinalityLimit(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetCardinalityLimit(1)
+	NewRegisteredCounter("foo", r)
+	if _, err := GetOrRegister(r, "bar", NewCounter); !errors.As(err, new(CardinalityLimitExceeded)) {
+		t.Errorf("GetOrRegister(bar): %v\n", err)
+	}
+}
+
+func TestGetOrRegisterStopsUnregistered(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetCardinalityLimit(1)
+	NewRegisteredCounter("foo", r)
+	var m *StandardMeter
+	newMeter := func() Meter {
+		m = NewMeter().(*StandardMeter)
+		return m
+	}
+	if _, err := GetOrRegister(r, "bar", newMeter); err == nil {
+		t.Fatal("GetOrRegister(bar) registered over the cardinality limit")
+	}
+	if 1 != m.stopped {
+		t.Errorf("unregistered meter was not stopped\n")
+	}
+}
+
+func TestGetOrRegisterUnregister(t *testing.T) {
+	r := NewRegistry()
+	m, err := GetOrRegister(r, "foo", NewMeter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Unregister("foo")
+	if 1 != m.(*StandardMeter).stopped {
+		t.Errorf("meter created by GetOrRegister was not stopped by Unregister\n")
+	}
+}
+
+func TestGetOrRegisterRegistryImplementation(t *testing.T) {
+	r := &prefixedRegistry{prefix: "p.", r: NewRegistry()}
+	c, err := GetOrRegister[Counter](r, "p.foo", NewCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Inc(47)
+	if c2, err := GetOrRegister(r, "p.foo", NewCounter); err != nil || c2 != c {
+		t.Errorf("GetOrRegister(p.foo): %v, %v\n", c2, err)
+	}
+	if _, err := GetOrRegister(r, "p.foo", NewGauge); !errors.As(err, new(*MetricTypeMismatch)) {
+		t.Errorf("GetOrRegister(p.foo): %v\n", err)
+	}
+	if count := r.Get("p.foo").(Counter).Count(); 47 != count {
+		t.Errorf("count: 47 != %v\n", count)
+	}
+}
+
+func TestGetOrRegisterConcurrent(t *testing.T) {
+	r := NewRegistry()
+	counters := make([]Counter, 16)
+	var wg sync.WaitGroup
+	for i := range counters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := GetOrRegister(r, "foo", NewCounter)
+			if err != nil {
+				t.Error(err)
+			}
+			c.Inc(1)
+			counters[i] = c
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range counters {
+		if c != counters[0] {
+			t.Fatal("goroutines got different counters")
+		}
+	}
+	if count := counters[0].Count(); 16 != count {
+		t.Errorf("count: 16 != %v\n", count)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("foo", r).Update(47)
+	if g, ok := Lookup[Gauge](r, "foo"); !ok || 47 != g.Value() {
+		t.Errorf("Lookup[Gauge](foo): %v, %v\n", g, ok)
+	}
+	if _, ok := Lookup[Counter](r, "foo"); ok {
+		t.Errorf("Lookup[Counter](foo) found a Gauge\n")
+	}
+	if _, ok := Lookup[Gauge](r, "bar"); ok {
+		t.Errorf("Lookup[Gauge](bar) found a metric\n")
+	}
+}
+
+func TestMustGet(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredText("foo", r).Set("bar")
+	if text := MustGet[Text](r, "foo").Text(); "bar" != text {
+		t.Errorf("MustGet[Text](foo).Text(): bar != %v\n", text)
+	}
+	for _, name := range []string{"foo", "missing"} {
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.As(err, new(*MetricTypeMismatch)) && !errors.As(err, new(MetricNotFound)) {
+					t.Errorf("MustGet[Counter](%s) panicked with %v\n", name, err)
+				}
+			}()
+			MustGet[Counter](r, name)
+		}()
+	}
+}
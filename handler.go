@@ -0,0 +1,285 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// JsonContentType is the content type of the output of GetAllJson.
+const JsonContentType = "application/json"
+
+// HandlerOptions configure the http.Handler built by Handler.
+type HandlerOption func(*handler)
+
+// WithFormat adds a format the handler can serve, or replaces the format of
+// the same name. It is chosen by the format query parameter, or by an Accept
+// header that prefers its content type. The write function writes the
+// metrics of the registry, which only holds the metrics named by the filter
+// query parameter, if any.
+func WithFormat(name, contentType string, write func(io.Writer, Registry) error) HandlerOption {
+	return func(h *handler) {
+		f := &handlerFormat{name: name, contentType: contentType, write: write}
+		f.mediaType, _, _ = mime.ParseMediaType(contentType)
+		for i, existing := range h.formats {
+			if existing.name == name {
+				h.formats[i] = f
+				return
+			}
+		}
+		h.formats = append(h.formats, f)
+	}
+}
+
+// Handler returns an http.Handler that serves the metrics of a registry of
+// any implementation. It serves the output of GetAllJson unless another
+// format is asked for, by the Accept header or by the format query parameter,
+// which is one of "json", "prometheus", "openmetrics" or a format added by
+// WithFormat. The handler also supports the query parameters:
+//
+//   - filter, a comma separated list of globs such as "http.*" matched
+//     against the names of the metrics of the registry, serving only the
+//     metrics whose name matches one of them. The parameter can be repeated.
+//   - pretty, which indents the JSON output if it is "1" or "true".
+//
+// The output is compressed with gzip for clients that accept it. An unknown
+// format or an invalid glob is answered with 400 Bad Request, and a failure
+// to write the metrics with 500 Internal Server Error.
+func Handler(r Registry, opts ...HandlerOption) http.Handler {
+	h := &handler{registry: r}
+	WithFormat("json", JsonContentType, writeJson)(h)
+	WithFormat("prometheus", PrometheusContentType, WritePrometheus)(h)
+	WithFormat("openmetrics", OpenMetricsContentType, WriteOpenMetrics)(h)
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+type handler struct {
+	registry Registry
+	formats  []*handlerFormat
+}
+
+type handlerFormat struct {
+	name        string
+	contentType string
+	mediaType   string
+	write       func(io.Writer, Registry) error
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Encoding")
+	query := req.URL.Query()
+
+	f := h.negotiate(req.Header.Get("Accept"))
+	if name := query.Get("format"); name != "" {
+		if f = h.format(name); f == nil {
+			http.Error(w, fmt.Sprintf("unknown format %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var r Registry = h.registry
+	if filters := query["filter"]; len(filters) > 0 {
+		filtered := &filteredRegistry{registry: r}
+		for _, filter := range filters {
+			for _, pattern := range strings.Split(filter, ",") {
+				if _, err := path.Match(pattern, ""); err != nil {
+					http.Error(w, fmt.Sprintf("invalid filter %q: %v", pattern, err), http.StatusBadRequest)
+					return
+				}
+				filtered.patterns = append(filtered.patterns, pattern)
+			}
+		}
+		r = filtered
+	}
+
+	var buf bytes.Buffer
+	if err := f.write(&buf, r); err != nil {
+		http.Error(w, fmt.Sprintf("error writing metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if pretty, _ := strconv.ParseBool(query.Get("pretty")); pretty && f.mediaType == JsonContentType {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, buf.Bytes(), "", "  "); err == nil {
+			buf = indented
+		}
+	}
+
+	w.Header().Set("Content-Type", f.contentType)
+	if !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	gz.Write(buf.Bytes())
+	gz.Close()
+}
+
+// format returns the format of the given name, or nil if there is none.
+func (h *handler) format(name string) *handlerFormat {
+	for _, f := range h.formats {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// negotiate returns the format whose content type is preferred by an Accept
+// header, the most specific media range breaking ties, or the JSON format if
+// the header prefers none of them. The quality of a format is that of the
+// most specific media range matching it, so "application/json;q=0, */*"
+// excludes JSON.
+func (h *handler) negotiate(accept string) *handlerFormat {
+	type weightedRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []weightedRange
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, weightedRange{mediaType, q})
+	}
+
+	best, bestQ, bestSpecificity := h.format("json"), 0.0, 0
+	for _, f := range h.formats {
+		q, specificity := 0.0, 0
+		for _, r := range ranges {
+			if s := mediaRangeSpecificity(r.mediaType, f.mediaType); s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ || (q > 0 && q == bestQ && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = f, q, specificity
+		}
+	}
+	return best
+}
+
+// mediaRangeSpecificity returns 3 if a media range is the given media type, 2
+// if it is of the form "text/*" and matches it, 1 for "*/*", and 0 if it does
+// not match it.
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 3
+	case mediaRange == "*/*":
+		return 1
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 2
+	}
+	return 0
+}
+
+// acceptsGzip returns whether an Accept-Encoding header accepts gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		params = strings.TrimSpace(params)
+		if q, ok := strings.CutPrefix(params, "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writeJson writes the output of GetAllJson.
+func writeJson(w io.Writer, r Registry) error {
+	b, err := r.GetAllJson()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// filteredRegistry is a read-only view of the metrics of a registry whose
+// names match any of a set of globs. It is output with the settings of the
+// registry it filters.
+type filteredRegistry struct {
+	registry Registry
+	patterns []string
+}
+
+// match returns whether a name matches any of the globs.
+func (f *filteredRegistry) match(name string) bool {
+	for _, pattern := range f.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Each calls the given function for each metric whose name matches.
+func (f *filteredRegistry) Each(fn func(string, interface{})) {
+	f.registry.Each(func(name string, i interface{}) {
+		if f.match(name) {
+			fn(name, i)
+		}
+	})
+}
+
+// Get returns the metric by the given name, or nil if it does not match.
+func (f *filteredRegistry) Get(name string) interface{} {
+	if !f.match(name) {
+		return nil
+	}
+	return f.registry.Get(name)
+}
+
+// GetAllJson outputs the metrics whose name matches in JSON format.
+func (f *filteredRegistry) GetAllJson() ([]byte, error) {
+	return RegistryJson(f)
+}
+
+// MetricCount returns the number of metrics whose name matches.
+func (f *filteredRegistry) MetricCount() int {
+	n := 0
+	f.Each(func(string, interface{}) { n++ })
+	return n
+}
+
+// Register returns an error, as the view cannot change the registry.
+func (f *filteredRegistry) Register(name string, i interface{}) error {
+	return fmt.Errorf("cannot register %s in a filtered view of a registry", name)
+}
+
+// Unregister does nothing, as the view cannot change the registry.
+func (f *filteredRegistry) Unregister(string) {}
+
+// exportOptions returns the export options of the registry it filters.
+func (f *filteredRegistry) exportOptions(parent exportOptions) exportOptions {
+	if p, ok := f.registry.(exportOptionsProvider); ok {
+		return p.exportOptions(parent)
+	}
+	return parent
+}
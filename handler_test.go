@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve requests the target from a handler of the registry with the given
+// headers, and returns the response and its decompressed body.
+func serve(t *testing.T, h http.Handler, target string, headers ...string) (*http.Response, string) {
+	req := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	resp := rec.Result()
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = gz
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func handlerTestRegistry() Registry {
+	r := NewRegistry()
+	NewRegisteredCounter("http.requests", r).Inc(3)
+	NewRegisteredCounter("http.errors", r).Inc(1)
+	NewRegisteredGauge("queue.depth", r).Update(7)
+	return r
+}
+
+func TestHandlerJson(t *testing.T) {
+	r := handlerTestRegistry()
+	resp, body := serve(t, Handler(r), "/metrics")
+	if ct := resp.Header.Get("Content-Type"); JsonContentType != ct {
+		t.Errorf("Content-Type: %v != %v\n", JsonContentType, ct)
+	}
+	want, _ := r.GetAllJson()
+	if string(want) != body {
+		t.Errorf("body: %s != %s\n", want, body)
+	}
+	if vary := resp.Header.Values("Vary"); 2 != len(vary) {
+		t.Errorf("Vary: %v\n", vary)
+	}
+}
+
+func TestHandlerNegotiation(t *testing.T) {
+	h := Handler(handlerTestRegistry())
+	for _, c := range []struct {
+		target, accept, contentType string
+	}{
+		{"/", "", JsonContentType},
+		{"/", "*/*", JsonContentType},
+		{"/", "text/html", JsonContentType},
+		{"/", "text/plain", PrometheusContentType},
+		{"/", "text/*;q=0.5, application/json;q=0.4", PrometheusContentType},
+		{"/", "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", OpenMetricsContentType},
+		{"/", "application/openmetrics-text;q=0, text/plain;q=0.1", PrometheusContentType},
+		{"/", "application/json;q=0, */*", PrometheusContentType},
+		{"/", "application/json;q=0, text/*;q=0, */*", OpenMetricsContentType},
+		{"/", "*/*;q=0", JsonContentType},
+		{"/?format=prometheus", "application/json", PrometheusContentType},
+		{"/?format=openmetrics", "", OpenMetricsContentType},
+		{"/?format=json", "text/plain", JsonContentType},
+	} {
+		resp, body := serve(t, h, c.target, "Accept", c.accept)
+		if ct := resp.Header.Get("Content-Type"); c.contentType != ct {
+			t.Errorf("%s Accept %q: Content-Type: %v != %v\n", c.target, c.accept, c.contentType, ct)
+		}
+		if c.contentType == OpenMetricsContentType && !strings.HasSuffix(body, "# EOF\n") {
+			t.Errorf("%s Accept %q: body %q\n", c.target, c.accept, body)
+		}
+	}
+}
+
+func TestHandlerFilter(t *testing.T) {
+	r := handlerTestRegistry()
+	NewRegisteredTimer("latency", r).Update(2 * time.Millisecond)
+	r.(*StandardRegistry).SetTimerUnit(time.Millisecond)
+	h := Handler(r)
+	_, body := serve(t, h, "/?filter=http.*")
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &values); err != nil {
+		t.Fatal(err)
+	}
+	if 2 != len(values) || nil == values["http.requests"] || nil == values["http.errors"] {
+		t.Errorf("filter=http.*: %v\n", values)
+	}
+
+	_, body = serve(t, h, "/?filter=queue.*,latency&filter=http.errors")
+	values = nil
+	if err := json.Unmarshal([]byte(body), &values); err != nil {
+		t.Fatal(err)
+	}
+	if 3 != len(values) || nil != values["http.requests"] {
+		t.Errorf("filter=queue.*,latency&filter=http.errors: %v\n", values)
+	}
+	latency := values["latency"].(map[string]interface{})
+	if unit := latency["unit"]; "ms" != unit {
+		t.Errorf("latency unit of a filtered registry: ms != %v\n", unit)
+	}
+
+	_, body = serve(t, h, "/?format=prometheus&filter=queue.depth")
+	if want := "# TYPE queue_depth gauge\nqueue_depth 7\n"; want != body {
+		t.Errorf("filter=queue.depth: %q != %q\n", want, body)
+	}
+
+	resp, _ := serve(t, h, "/?filter=[")
+	if http.StatusBadRequest != resp.StatusCode {
+		t.Errorf("filter=[: %v != %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestHandlerFilterReadOnly(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("foo", r).Update(3)
+	var registerErr error
+	h := Handler(r, WithFormat("mutate", "text/plain", func(w io.Writer, r Registry) error {
+		registerErr = r.Register("bar", NewCounter())
+		r.Unregister("foo")
+		return nil
+	}))
+	serve(t, h, "/?format=mutate&filter=*")
+	if nil == registerErr {
+		t.Errorf("Register on a filtered registry: nil error\n")
+	}
+	if nil == r.Get("foo") || nil != r.Get("bar") {
+		t.Errorf("filtered registry changed the registry: foo %v, bar %v\n", r.Get("foo"), r.Get("bar"))
+	}
+}
+
+func TestHandlerPretty(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(1)
+	h := Handler(r)
+	if _, body := serve(t, h, "/?pretty=1"); "{\n  \"foo\": 1\n}" != body {
+		t.Errorf("pretty=1: %q\n", body)
+	}
+	if _, body := serve(t, h, "/?pretty=0"); `{"foo":1}` != body {
+		t.Errorf("pretty=0: %q\n", body)
+	}
+	if _, body := serve(t, h, "/?pretty=1&format=prometheus"); "# TYPE foo_total counter\nfoo_total 1\n" != body {
+		t.Errorf("pretty=1&format=prometheus: %q\n", body)
+	}
+}
+
+func TestHandlerGzip(t *testing.T) {
+	r := handlerTestRegistry()
+	h := Handler(r)
+	want, _ := r.GetAllJson()
+	for encoding, gzipped := range map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"gzip;q=0":            false,
+		"*":                   true,
+		"br":                  false,
+	} {
+		resp, body := serve(t, h, "/", "Accept-Encoding", encoding)
+		if ce := resp.Header.Get("Content-Encoding"); gzipped != ("gzip" == ce) {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q\n", encoding, ce)
+		}
+		if string(want) != body {
+			t.Errorf("Accept-Encoding %q: body %s != %s\n", encoding, body, want)
+		}
+	}
+}
+
+func TestHandlerFormats(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("foo", r).Update(3)
+	h := Handler(r,
+		WithFormat("csv", "text/csv", func(w io.Writer, r Registry) error {
+			r.Each(func(name string, i interface{}) {
+				fmt.Fprintf(w, "%s,%d\n", name, i.(Gauge).Value())
+			})
+			return nil
+		}),
+		WithFormat("prometheus", "text/plain", func(w io.Writer, r Registry) error {
+			return fmt.Errorf("unavailable")
+		}),
+	)
+	if resp, body := serve(t, h, "/", "Accept", "text/csv"); "text/csv" != resp.Header.Get("Content-Type") || "foo,3\n" != body {
+		t.Errorf("Accept text/csv: %v %q\n", resp.Header.Get("Content-Type"), body)
+	}
+	if _, body := serve(t, h, "/?format=csv"); "foo,3\n" != body {
+		t.Errorf("format=csv: %q\n", body)
+	}
+	if resp, _ := serve(t, h, "/?format=prometheus"); http.StatusInternalServerError != resp.StatusCode {
+		t.Errorf("format=prometheus: %v != %v\n", http.StatusInternalServerError, resp.StatusCode)
+	}
+	if resp, _ := serve(t, h, "/?format=xml"); http.StatusBadRequest != resp.StatusCode {
+		t.Errorf("format=xml: %v != %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+}
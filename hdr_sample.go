@@ -0,0 +1,291 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// HDRSample is a sample backed by a High Dynamic Range histogram. It counts
+// every recorded value in log-linear buckets, so percentiles are accurate to
+// the configured number of significant digits while memory use stays fixed.
+// Count, Min, Max, Sum and Mean are exact. See Gil Tene's HdrHistogram.
+//
+// <http://hdrhistogram.org/>
+type HDRSample struct {
+	lowest, highest int64
+	sigfigs         int
+
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketCount              int
+	subBucketHalfCount          int
+	subBucketMask               int64
+
+	mutex    sync.Mutex
+	counts   []int64
+	count    int64
+	min, max int64
+	sum      int64
+	mean, m2 float64
+}
+
+// NewHDRSample constructs a new HDR histogram sample that tracks values
+// between lowest and highest with the given number of significant decimal
+// digits, between 1 and 5. Values below lowest are counted with a resolution
+// of lowest, values above highest are counted as highest. It panics if the
+// arguments cannot describe a histogram.
+func NewHDRSample(lowest, highest int64, sigfigs int) Sample {
+	if lowest < 1 {
+		panic(fmt.Sprintf("metrics: HDR sample lowest value %d must be at least 1", lowest))
+	}
+	if highest < 2*lowest {
+		panic(fmt.Sprintf("metrics: HDR sample highest value %d must be at least twice the lowest value %d", highest, lowest))
+	}
+	if sigfigs < 1 || sigfigs > 5 {
+		panic(fmt.Sprintf("metrics: HDR sample significant digits %d must be between 1 and 5", sigfigs))
+	}
+
+	s := &HDRSample{lowest: lowest, highest: highest, sigfigs: sigfigs}
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(sigfigs)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	s.subBucketHalfCountMagnitude = subBucketCountMagnitude - 1
+	s.unitMagnitude = uint(bits.Len64(uint64(lowest)) - 1)
+	s.subBucketCount = 1 << subBucketCountMagnitude
+	s.subBucketHalfCount = s.subBucketCount / 2
+	s.subBucketMask = int64(s.subBucketCount-1) << s.unitMagnitude
+
+	// Each bucket doubles the range of the one before, find how many are
+	// needed to reach the highest trackable value.
+	smallestUntrackable := int64(s.subBucketCount) << s.unitMagnitude
+	bucketCount := 1
+	for smallestUntrackable <= highest {
+		if smallestUntrackable > math.MaxInt64/2 {
+			bucketCount++
+			break
+		}
+		smallestUntrackable <<= 1
+		bucketCount++
+	}
+	s.counts = make([]int64, (bucketCount+1)*s.subBucketHalfCount)
+	s.reset()
+	return s
+}
+
+// Clear clears all samples.
+func (s *HDRSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.counts {
+		s.counts[i] = 0
+	}
+	s.reset()
+}
+
+// Count returns the number of samples recorded.
+func (s *HDRSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value ever recorded.
+func (s *HDRSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == s.count {
+		return 0
+	}
+	return s.max
+}
+
+// Mean returns the mean of the recorded values.
+func (s *HDRSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.mean
+}
+
+// Min returns the minimum value ever recorded.
+func (s *HDRSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == s.count {
+		return 0
+	}
+	return s.min
+}
+
+// Percentile returns an arbitrary percentile of the recorded values, within
+// the relative error of the sample's significant digits.
+func (s *HDRSample) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the recorded
+// values, within the relative error of the sample's significant digits.
+func (s *HDRSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	scores := make([]float64, len(ps))
+	if 0 == s.count {
+		return scores
+	}
+	for i, p := range ps {
+		scores[i] = float64(s.valueAtPercentile(p))
+	}
+	return scores
+}
+
+// Size returns the number of distinct buckets values have been counted in.
+func (s *HDRSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	size := 0
+	for _, c := range s.counts {
+		if c > 0 {
+			size++
+		}
+	}
+	return size
+}
+
+// StdDev returns the standard deviation of the recorded values.
+func (s *HDRSample) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the recorded values.
+func (s *HDRSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update records a new value.  It does not allocate.
+func (s *HDRSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	s.sum += v
+	if v < s.min {
+		s.min = v
+	}
+	if v > s.max {
+		s.max = v
+	}
+	// Welford's online algorithm keeps the variance exact without storing
+	// the values.
+	d := float64(v) - s.mean
+	s.mean += d / float64(s.count)
+	s.m2 += d * (float64(v) - s.mean)
+
+	s.counts[s.countsIndexFor(v)]++
+}
+
+// Values returns one value for each bucket values have been counted in, from
+// lowest to highest. Each value stands for every recorded value that is
+// equivalent to it within the sample's precision.
+func (s *HDRSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := []int64{}
+	for i, c := range s.counts {
+		if c > 0 {
+			values = append(values, s.medianEquivalentValue(s.valueFromCountsIndex(i)))
+		}
+	}
+	return values
+}
+
+// Variance returns the variance of the recorded values.
+func (s *HDRSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == s.count {
+		return 0.0
+	}
+	return s.m2 / float64(s.count)
+}
+
+func (s *HDRSample) reset() {
+	s.count = 0
+	s.sum = 0
+	s.min = math.MaxInt64
+	s.max = math.MinInt64
+	s.mean = 0
+	s.m2 = 0
+}
+
+// valueAtPercentile returns the highest value equivalent to the value at the
+// given percentile, bounded by the exact minimum and maximum.
+func (s *HDRSample) valueAtPercentile(p float64) int64 {
+	if p <= 0 {
+		return s.min
+	}
+	target := int64(math.Ceil(math.Min(p, 1) * float64(s.count)))
+	var total int64
+	for i, c := range s.counts {
+		total += c
+		if total >= target {
+			v := s.highestEquivalentValue(s.valueFromCountsIndex(i))
+			return max(s.min, min(v, s.max))
+		}
+	}
+	return s.max
+}
+
+func (s *HDRSample) countsIndexFor(v int64) int {
+	if v < 0 {
+		v = 0
+	}
+	if v > s.highest {
+		v = s.highest
+	}
+	bucketIdx := s.bucketIndex(v)
+	subBucketIdx := s.subBucketIndex(v, bucketIdx)
+	return s.countsIndex(bucketIdx, subBucketIdx)
+}
+
+func (s *HDRSample) bucketIndex(v int64) int {
+	pow2Ceiling := bits.Len64(uint64(v | s.subBucketMask))
+	return pow2Ceiling - int(s.unitMagnitude) - int(s.subBucketHalfCountMagnitude+1)
+}
+
+func (s *HDRSample) subBucketIndex(v int64, bucketIdx int) int {
+	return int(v >> (uint(bucketIdx) + s.unitMagnitude))
+}
+
+func (s *HDRSample) countsIndex(bucketIdx, subBucketIdx int) int {
+	bucketBaseIdx := (bucketIdx + 1) << s.subBucketHalfCountMagnitude
+	return bucketBaseIdx + subBucketIdx - s.subBucketHalfCount
+}
+
+func (s *HDRSample) valueFromCountsIndex(i int) int64 {
+	bucketIdx := (i >> s.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := (i & (s.subBucketHalfCount - 1)) + s.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= s.subBucketHalfCount
+		bucketIdx = 0
+	}
+	return int64(subBucketIdx) << (uint(bucketIdx) + s.unitMagnitude)
+}
+
+// equivalentRange returns the size of the range of values counted in the
+// same bucket as v.
+func (s *HDRSample) equivalentRange(v int64) int64 {
+	bucketIdx := s.bucketIndex(v)
+	if s.subBucketIndex(v, bucketIdx) >= s.subBucketCount {
+		bucketIdx++
+	}
+	return 1 << (s.unitMagnitude + uint(bucketIdx))
+}
+
+func (s *HDRSample) highestEquivalentValue(v int64) int64 {
+	return v + s.equivalentRange(v) - 1
+}
+
+func (s *HDRSample) medianEquivalentValue(v int64) int64 {
+	return v + s.equivalentRange(v)>>1
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+func BenchmarkHDRSample(b *testing.B) {
+	benchmarkSample(b, NewHDRSample(1, 3600000000000, 3))
+}
+
+func TestHDRSample10000(t *testing.T) {
+	h := NewHistogram(NewHDRSample(1, 100000, 3))
+	for i := 1; i <= 10000; i++ {
+		h.Update(int64(i))
+	}
+	if count := h.Count(); 10000 != count {
+		t.Errorf("h.Count(): 10000 != %v\n", count)
+	}
+	if min := h.Min(); 1 != min {
+		t.Errorf("h.Min(): 1 != %v\n", min)
+	}
+	if max := h.Max(); 10000 != max {
+		t.Errorf("h.Max(): 10000 != %v\n", max)
+	}
+	if mean := h.Mean(); 5000.5 != mean {
+		t.Errorf("h.Mean(): 5000.5 != %v\n", mean)
+	}
+	if sum := h.Sum(); 50005000 != sum {
+		t.Errorf("h.Sum(): 50005000 != %v\n", sum)
+	}
+	if stdDev := h.StdDev(); math.Abs(2886.751331514372-stdDev) > 1e-6 {
+		t.Errorf("h.StdDev(): 2886.751331514372 != %v\n", stdDev)
+	}
+}
+
+func TestHDRSampleRelativeError(t *testing.T) {
+	for _, sigfigs := range []int{1, 2, 3, 4} {
+		s := NewHDRSample(1, 3600000000000, sigfigs)
+		values := make([]int64, 0, 100000)
+		// A spiky latency stream: mostly fast values with rare slow ones.
+		for i := 0; i < 100000; i++ {
+			v := int64(1000000 + i*37)
+			if i%1000 == 0 {
+				v = int64(10000000000 + i)
+			}
+			values = append(values, v)
+			s.Update(v)
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		ps := []float64{0.01, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 0.9999, 1}
+		scores := s.Percentiles(ps)
+		maxError := math.Pow10(-sigfigs)
+		for i, p := range ps {
+			exact := float64(values[int(math.Ceil(p*float64(len(values))))-1])
+			if err := math.Abs(scores[i]-exact) / exact; err > maxError {
+				t.Errorf("%d digits, %v percentile: %v != %v (error %v > %v)\n", sigfigs, p, scores[i], exact, err, maxError)
+			}
+		}
+		if max := s.Max(); values[len(values)-1] != max {
+			t.Errorf("s.Max(): %v != %v\n", values[len(values)-1], max)
+		}
+	}
+}
+
+func TestHDRSampleOutOfRange(t *testing.T) {
+	s := NewHDRSample(1, 1000, 2)
+	s.Update(-5)
+	s.Update(5000)
+	if min := s.Min(); -5 != min {
+		t.Errorf("s.Min(): -5 != %v\n", min)
+	}
+	if max := s.Max(); 5000 != max {
+		t.Errorf("s.Max(): 5000 != %v\n", max)
+	}
+	if count := s.Count(); 2 != count {
+		t.Errorf("s.Count(): 2 != %v\n", count)
+	}
+	if p := s.Percentile(1); 5000 < p || p < 1000 {
+		t.Errorf("s.Percentile(1): out of range [1000, 5000]: %v\n", p)
+	}
+}
+
+func TestHDRSampleClear(t *testing.T) {
+	s := NewHDRSample(1, 1000, 2)
+	s.Update(10)
+	s.Clear()
+	if count, size := s.Count(), s.Size(); 0 != count || 0 != size {
+		t.Errorf("s.Count(), s.Size() after clear: %v, %v\n", count, size)
+	}
+	if min, max := s.Min(), s.Max(); 0 != min || 0 != max {
+		t.Errorf("s.Min(), s.Max() after clear: %v, %v\n", min, max)
+	}
+	if p := s.Percentile(0.5); 0 != p {
+		t.Errorf("s.Percentile(0.5) after clear: %v\n", p)
+	}
+}
+
+func TestHDRSampleValues(t *testing.T) {
+	s := NewHDRSample(1, 100000, 2)
+	for i := 0; i < 10; i++ {
+		s.Update(50000)
+	}
+	s.Update(3)
+	values := s.Values()
+	if 2 != len(values) || 2 != s.Size() {
+		t.Fatalf("s.Values(): %v\n", values)
+	}
+	if 3 != values[0] {
+		t.Errorf("values[0]: 3 != %v\n", values[0])
+	}
+	if err := math.Abs(float64(values[1]-50000)) / 50000; err > 0.01 {
+		t.Errorf("values[1]: 50000 != %v\n", values[1])
+	}
+}
+
+func TestHDRSampleUpdateDoesNotAllocate(t *testing.T) {
+	s := NewHDRSample(1, 3600000000000, 3)
+	v := int64(0)
+	if allocs := testing.AllocsPerRun(1000, func() {
+		v += 7919
+		s.Update(v)
+	}); 0 != allocs {
+		t.Errorf("s.Update() allocations: 0 != %v\n", allocs)
+	}
+}
+
+func TestHDRSampleInvalid(t *testing.T) {
+	for _, args := range [][3]int64{{0, 100, 3}, {10, 15, 3}, {1, 100, 0}, {1, 100, 6}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewHDRSample%v did not panic", args)
+				}
+			}()
+			NewHDRSample(args[0], args[1], int(args[2]))
+		}()
+	}
+}
+
+func TestTimerHDRSample(t *testing.T) {
+	tm := NewTimerWithOptions(WithTimerSample(NewHDRSample(1, int64(time.Hour), 3)))
+	tm.Update(1500 * time.Microsecond)
+	tm.Update(250 * time.Millisecond)
+	if min := tm.Min(); 1500*time.Microsecond != min {
+		t.Errorf("tm.Min(): 1.5ms != %v", min)
+	}
+	if max := tm.Max(); 250*time.Millisecond != max {
+		t.Errorf("tm.Max(): 250ms != %v", max)
+	}
+	if p := tm.Percentile(0.5); math.Abs(float64(p-1500*time.Microsecond))/float64(1500*time.Microsecond) > 0.001 {
+		t.Errorf("tm.Percentile(0.5): 1.5ms != %v", p)
+	}
+}
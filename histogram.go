@@ -1,6 +1,10 @@
 package metrics
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
 
 // Histograms calculate distribution statistics from a series of int64 values.
 type Histogram interface {
@@ -8,9 +12,11 @@ type Histogram interface {
 	Count() int64
 	Max() int64
 	Mean() float64
+	Merge(Histogram) error
 	Min() int64
 	Percentile(float64) float64
 	Percentiles([]float64) []float64
+	OutputPercentiles() []float64
 	Sample() Sample
 	StdDev() float64
 	Sum() int64
@@ -19,18 +25,22 @@ type Histogram interface {
 }
 
 // NewHistogram constructs a new StandardHistogram from a Sample.
-func NewHistogram(s Sample) Histogram {
-	return &StandardHistogram{sample: s}
+func NewHistogram(s Sample, opts ...HistogramOption) Histogram {
+	h := &StandardHistogram{sample: s, sum: s.Sum()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // NewRegisteredHistogram constructs and registers a new StandardHistogram from
 // a Sample.
-func NewRegisteredHistogram(name string, r Registry, s Sample) Histogram {
-	c := NewHistogram(s)
+func NewRegisteredHistogram(name string, r Registry, s Sample, opts ...HistogramOption) Histogram {
+	c := NewHistogram(s, opts...)
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, c)
+	err := registerCreated(r, name, c)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -45,14 +55,31 @@ func GetHistogram(name string, r Registry) Histogram {
 	return r.Get(name).(Histogram)
 }
 
+// HistogramOptions configure a StandardHistogram built by NewHistogram.
+type HistogramOption func(*StandardHistogram)
+
+// WithHistogramPercentiles sets the percentiles output for the histogram,
+// such as 0.9 and 0.9999, instead of the percentiles of its registry.
+func WithHistogramPercentiles(ps ...float64) HistogramOption {
+	return func(h *StandardHistogram) {
+		h.percentiles = make([]float64, len(ps))
+		copy(h.percentiles, ps)
+	}
+}
+
 // StandardHistogram is the standard implementation of a Histogram and uses a
 // Sample to bound its memory use.
 type StandardHistogram struct {
-	sample Sample
+	sample      Sample
+	percentiles []float64
+	sum         int64
 }
 
 // Clear clears the histogram and its sample.
-func (h *StandardHistogram) Clear() { h.sample.Clear() }
+func (h *StandardHistogram) Clear() {
+	h.sample.Clear()
+	atomic.StoreInt64(&h.sum, 0)
+}
 
 // Count returns the number of samples recorded since the histogram was last
 // cleared.
@@ -64,6 +91,21 @@ func (h *StandardHistogram) Max() int64 { return h.sample.Max() }
 // Mean returns the mean of the values in the sample.
 func (h *StandardHistogram) Mean() float64 { return h.sample.Mean() }
 
+// Merge adds the values recorded by another histogram, for example one
+// decoded from the output of another process, to this histogram. Both
+// histograms must use the same kind of MergeableSample.
+func (h *StandardHistogram) Merge(other Histogram) error {
+	s, ok := h.sample.(MergeableSample)
+	if !ok {
+		return fmt.Errorf("%w: %T cannot be merged", ErrIncompatibleSample, h.sample)
+	}
+	if err := s.Merge(other.Sample()); err != nil {
+		return err
+	}
+	atomic.AddInt64(&h.sum, other.Sum())
+	return nil
+}
+
 // Min returns the minimum value in the sample.
 func (h *StandardHistogram) Min() int64 { return h.sample.Min() }
 
@@ -78,17 +120,64 @@ func (h *StandardHistogram) Percentiles(ps []float64) []float64 {
 	return h.sample.Percentiles(ps)
 }
 
+// OutputPercentiles returns the percentiles output for the histogram, or nil
+// if the percentiles of its registry are output.
+func (h *StandardHistogram) OutputPercentiles() []float64 {
+	return h.percentiles
+}
+
 // Sample returns the Sample underlying the histogram.
 func (h *StandardHistogram) Sample() Sample { return h.sample }
 
 // StdDev returns the standard deviation of the values in the sample.
 func (h *StandardHistogram) StdDev() float64 { return h.sample.StdDev() }
 
-// Sum returns the sum in the sample.
-func (h *StandardHistogram) Sum() int64 { return h.sample.Sum() }
+// Sum returns the sum of the values recorded since the histogram was last
+// cleared, not only of those kept by the sample, so that it goes with Count.
+func (h *StandardHistogram) Sum() int64 { return atomic.LoadInt64(&h.sum) }
 
 // Update samples a new value.
-func (h *StandardHistogram) Update(v int64) { h.sample.Update(v) }
+func (h *StandardHistogram) Update(v int64) {
+	h.sample.Update(v)
+	atomic.AddInt64(&h.sum, v)
+}
 
 // Variance returns the variance of the values in the sample.
 func (h *StandardHistogram) Variance() float64 { return h.sample.Variance() }
+
+// MarshalMetric returns the values of the histogram as output by a registry
+// with the default settings.
+func (h *StandardHistogram) MarshalMetric() (interface{}, error) {
+	return h.marshalMetricWith(defaultExportOptions), nil
+}
+
+func (h *StandardHistogram) marshalMetricWith(opts exportOptions) interface{} {
+	return histogramValue(h, opts)
+}
+
+// histogramValue returns the values a Histogram is output as, with its own
+// percentiles or else the percentiles of the registry. The sample of a
+// histogram built on a MergeableSample is included so it can be merged by
+// whoever reads the output.
+func histogramValue(h Histogram, opts exportOptions) map[string]interface{} {
+	percentiles := h.OutputPercentiles()
+	if percentiles == nil {
+		percentiles = opts.percentiles
+	}
+	ps := h.Percentiles(percentiles)
+	values := make(map[string]interface{})
+	values["count"] = h.Count()
+	values["min"] = h.Min()
+	values["max"] = h.Max()
+	values["mean"] = h.Mean()
+	values["stddev"] = h.StdDev()
+	for i, p := range percentiles {
+		values[percentileName(p)] = ps[i]
+	}
+	if s, ok := h.Sample().(MergeableSample); ok {
+		if b, err := s.MarshalBinary(); err == nil {
+			values["sample"] = b
+		}
+	}
+	return values
+}
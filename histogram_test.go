@@ -27,6 +27,20 @@ func TestHistogram10000(t *testing.T) {
 	testHistogram10000(t, h)
 }
 
+func TestHistogramSum(t *testing.T) {
+	h := NewHistogram(NewUniformSample(2))
+	for i := 0; i < 100; i++ {
+		h.Update(10)
+	}
+	if sum := h.Sum(); 1000 != sum {
+		t.Errorf("h.Sum(): 1000 != %v\n", sum)
+	}
+	h.Clear()
+	if sum := h.Sum(); 0 != sum {
+		t.Errorf("h.Sum(): 0 != %v\n", sum)
+	}
+}
+
 func TestHistogramEmpty(t *testing.T) {
 	h := NewHistogram(NewExpDecaySample(100000, 0))
 	if count := h.Count(); 0 != count {
@@ -83,3 +97,63 @@ func testHistogram10000(t *testing.T, h Histogram) {
 		t.Errorf("99th percentile: 9900.99 != %v\n", ps[2])
 	}
 }
+
+func TestHistogramPercentileNames(t *testing.T) {
+	for p, name := range map[float64]string{
+		0.5:    "median",
+		0.57:   "57%",
+		0.9:    "90%",
+		0.999:  "99.9%",
+		0.9999: "99.99%",
+	} {
+		if n := percentileName(p); name != n {
+			t.Errorf("percentileName(%v): %s != %s", p, name, n)
+		}
+	}
+}
+
+func TestHistogramOutputPercentiles(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredHistogram("foo", r, NewExpDecaySample(100000, 0), WithHistogramPercentiles(0.9, 0.9999))
+	NewRegisteredHistogram("bar", r, NewExpDecaySample(100000, 0))
+	for i := 1; i <= 10000; i++ {
+		h.Update(int64(i))
+	}
+	values := registryValues(t, r)
+	foo := values["foo"].(map[string]interface{})
+	if p := foo["90%"]; 9000.9 != p {
+		t.Errorf("90%%: 9000.9 != %v", p)
+	}
+	if p := foo["99.99%"]; 9999.9999 != p {
+		t.Errorf("99.99%%: 9999.9999 != %v", p)
+	}
+	if _, ok := foo["median"]; ok {
+		t.Error("median is output")
+	}
+	bar := values["bar"].(map[string]interface{})
+	for _, key := range []string{"median", "75%", "95%", "99%", "99.9%"} {
+		if _, ok := bar[key]; !ok {
+			t.Errorf("%s is not output", key)
+		}
+	}
+}
+
+func TestHistogramRegistryPercentiles(t *testing.T) {
+	r := NewRegistry()
+	nested := NewRegistry()
+	r.Register("nested", nested)
+	NewRegisteredHistogram("foo", nested, NewExpDecaySample(100000, 0)).Update(1)
+	NewRegisteredTimer("bar", nested).Update(1)
+
+	r.(*StandardRegistry).SetPercentiles([]float64{0.25})
+	values := registryValues(t, r)["nested"].(map[string]interface{})
+	for _, name := range []string{"foo", "bar"} {
+		metric := values[name].(map[string]interface{})
+		if _, ok := metric["25%"]; !ok {
+			t.Errorf("%s: 25%% is not output", name)
+		}
+		if _, ok := metric["median"]; ok {
+			t.Errorf("%s: median is output", name)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"encoding/json"
 	"os"
+	"sync"
 )
 
 // Json is a basic string message that can be set and appended to
@@ -23,7 +24,7 @@ func NewRegisteredJson(name string, r Registry) Json {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, j)
+	err := registerCreated(r, name, j)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -38,22 +39,44 @@ func GetJson(name string, r Registry) Json {
 	return r.Get(name).(Json)
 }
 
-// StandardJson is the standard implementation of a Json value
+// StandardJson is the standard implementation of a Json value and is safe
+// for concurrent use. It keeps its own copy of the msg value, so the caller
+// may reuse the messages it passes and is passed.
 type StandardJson struct {
-	raw json.RawMessage
+	mutex sync.RWMutex
+	raw   json.RawMessage
 }
 
 // Clear removes the current msg value
 func (t *StandardJson) Clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.raw = nil
 }
 
-// Json returns the msg value
+// Json returns a copy of the msg value
 func (t *StandardJson) Json() json.RawMessage {
-	return t.raw
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return copyRawMessage(t.raw)
 }
 
-// Set changes the msg value to the indicated string
+// Set changes the msg value to a copy of the indicated message
 func (t *StandardJson) Set(j json.RawMessage) {
+	j = copyRawMessage(j)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.raw = j
 }
+
+func copyRawMessage(j json.RawMessage) json.RawMessage {
+	if nil == j {
+		return nil
+	}
+	return append(json.RawMessage{}, j...)
+}
+
+// MarshalMetric returns the msg value, as output by the registry.
+func (t *StandardJson) MarshalMetric() (interface{}, error) {
+	return t.Json(), nil
+}
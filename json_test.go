@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"encoding/json"
+	"sync"
 	"testing"
 )
 
@@ -65,3 +66,37 @@ func TestGetJson(t *testing.T) {
 		t.Fatal(js)
 	}
 }
+
+func TestJsonSetCopies(t *testing.T) {
+	js := NewJson()
+	raw := getRawJson(t)
+	want := string(raw)
+	js.Set(raw)
+	raw[0] = ' '
+	if Json := js.Json(); want != string(Json) {
+		t.Errorf("js.Json(): %s != %s", string(Json), want)
+	}
+	js.Json()[0] = ' '
+	if Json := js.Json(); want != string(Json) {
+		t.Errorf("js.Json(): %s != %s", string(Json), want)
+	}
+}
+
+func TestJsonConcurrent(t *testing.T) {
+	js := NewJson()
+	raw := getRawJson(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				js.Set(raw)
+				if Json := js.Json(); string(raw) != string(Json) {
+					t.Errorf("js.Json(): %s != %s", string(Json), string(raw))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
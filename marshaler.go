@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedMetric is the error returned by Registry.Register when the
+// value is not a metric the registry can output.
+var ErrUnsupportedMetric = errors.New("unsupported metric")
+
+// MetricMarshalers are metrics whose output is defined by the metric itself,
+// allowing types from outside this package, such as the state of a circuit
+// breaker, to be registered. The registry outputs the value returned by
+// MarshalMetric, which must be encodable as JSON, in place of the metric.
+type MetricMarshaler interface {
+	MarshalMetric() (interface{}, error)
+}
+
+// marshalMetric returns the output of a MetricMarshaler. An error or panic is
+// reported as the value instead of failing the output of the whole registry.
+func marshalMetric(m MetricMarshaler) interface{} {
+	return recoverValue(func() interface{} {
+		value, err := m.MarshalMetric()
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+		return value
+	})
+}
+
+// unsupportedMetric returns the error for registering a value of an
+// unsupported type under the given name.
+func unsupportedMetric(name string, i interface{}) error {
+	return fmt.Errorf("%w: %s is a %T", ErrUnsupportedMetric, name, i)
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// breakerState is a metric defined outside of the package's metric types.
+type breakerState struct {
+	state    string
+	failures int
+	err      error
+}
+
+func (b *breakerState) MarshalMetric() (interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return map[string]interface{}{"state": b.state, "failures": b.failures}, nil
+}
+
+func TestRegisterUnsupportedMetric(t *testing.T) {
+	r := NewRegistry()
+	for _, i := range []interface{}{47, struct{}{}, nil} {
+		if err := r.Register("foo", i); !errors.Is(err, ErrUnsupportedMetric) {
+			t.Errorf("r.Register(%#v): %v\n", i, err)
+		}
+	}
+	if count := r.MetricCount(); 0 != count {
+		t.Errorf("r.MetricCount(): 0 != %v\n", count)
+	}
+	if _, err := GetOrRegister(r, "foo", func() int { return 47 }); !errors.Is(err, ErrUnsupportedMetric) {
+		t.Errorf("GetOrRegister(foo): %v\n", err)
+	}
+}
+
+func TestRegistryMetricMarshaler(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("breaker", &breakerState{state: "open", failures: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("broken", &breakerState{err: errors.New("unavailable")}); err != nil {
+		t.Fatal(err)
+	}
+	values := registryValues(t, r)
+	if expected := map[string]interface{}{"state": "open", "failures": 3.0}; !reflect.DeepEqual(expected, values["breaker"]) {
+		t.Errorf("breaker: %v != %v\n", expected, values["breaker"])
+	}
+	if expected := map[string]interface{}{"error": "unavailable"}; !reflect.DeepEqual(expected, values["broken"]) {
+		t.Errorf("broken: %v != %v\n", expected, values["broken"])
+	}
+}
+
+// Every metric of the package can be output by exporters through
+// MetricMarshaler.
+var _ = []MetricMarshaler{
+	&StandardCounter{},
+	&StandardGauge{},
+	GaugeSnapshot(0),
+	&FunctionalGauge{},
+	&StandardGaugeFloat64{},
+	GaugeFloat64Snapshot(0),
+	&FunctionalGaugeFloat64{},
+	&StandardMeter{},
+	&MeterSnapshot{},
+	&StandardTimer{},
+	&StandardHistogram{},
+	&StandardBucketedHistogram{},
+	&BucketedHistogramSnapshot{},
+	&StandardSummary{},
+	&StandardCounterVec{},
+	&StandardGaugeVec{},
+	&StandardTimerVec{},
+	&StandardHistogramVec{},
+	&StandardText{},
+	&StandardJson{},
+	&StandardSlice{},
+	&StandardRegistry{},
+}
+
+func TestMetricMarshalerBuiltin(t *testing.T) {
+	timer := NewTimer()
+	timer.Update(1500 * time.Millisecond)
+	value, err := timer.(MetricMarshaler).MarshalMetric()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := value.(map[string]interface{})
+	if max, unit := values["max"], values["unit"]; 1.5 != max || "s" != unit {
+		t.Errorf("max, unit: %v, %v\n", max, unit)
+	}
+
+	c := NewCounter()
+	c.Inc(47)
+	r := registryWith("foo", c)
+	value, err = r.(MetricMarshaler).MarshalMetric()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"foo": int64(47)}; !reflect.DeepEqual(expected, value) {
+		t.Errorf("r.MarshalMetric(): %v != %v\n", expected, value)
+	}
+}
+
+// plainCounter implements Counter without implementing MetricMarshaler.
+type plainCounter struct{ count int64 }
+
+func (c *plainCounter) Clear()       { c.count = 0 }
+func (c *plainCounter) Count() int64 { return c.count }
+func (c *plainCounter) Dec(i int64)  { c.count -= i }
+func (c *plainCounter) Inc(i int64)  { c.count += i }
+func (c *plainCounter) Set(i int64)  { c.count = i }
+
+func TestRegistryPlainInterface(t *testing.T) {
+	c := &plainCounter{}
+	c.Inc(47)
+	if count := registryValues(t, registryWith("foo", c))["foo"]; 47.0 != count {
+		t.Errorf("foo: 47 != %v\n", count)
+	}
+}
@@ -3,27 +3,38 @@ package metrics
 import (
 	"math"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // Meters track set values and how the value changes over time
-// each time it is recorded
+// each time it is recorded, as well as the rate at which values are recorded
 type Meter interface {
 	Count() int64      // Number of times the meter has saved a value
 	Mark(int64)        // Set a value in the meter
 	RateMean() float64 // Get the mean value from the meter
 	LastValue() int64  // Get the most recently saved value
+	Rate() float64     // Mean rate of marks per second since the meter was created
+	Rate1() float64    // One-minute moving average rate of marks per second
+	Rate5() float64    // Five-minute moving average rate of marks per second
+	Rate15() float64   // Fifteen-minute moving average rate of marks per second
 	Snapshot() Meter   // Save a snapshot of the current state
+	Stop()             // Stop updating the moving average rates
 }
 
 // NewMeter constructs a new StandardMeter and launches a goroutine.
 // Be sure to call Stop() once the meter is of no use to allow for garbage collection.
 func NewMeter() Meter {
-	return &StandardMeter{
+	m := &StandardMeter{
 		snapshot:  &MeterSnapshot{},
 		startTime: time.Now(),
+		a1:        NewEWMA1(),
+		a5:        NewEWMA5(),
+		a15:       NewEWMA15(),
 	}
+	arbiter.add(m)
+	return m
 }
 
 // NewMeter constructs and registers a new StandardMeter and launches a
@@ -35,7 +46,7 @@ func NewRegisteredMeter(name string, r Registry) Meter {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, c)
+	err := registerCreated(r, name, c)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -52,10 +63,11 @@ func GetMeter(name string, r Registry) Meter {
 
 // MeterSnapshot is a read-only copy of another Meter.
 type MeterSnapshot struct {
-	count     int64
-	value     int64
-	rateMean  uint64
-	lastValue int64
+	count                      int64
+	value                      int64
+	rateMean                   uint64
+	lastValue                  int64
+	rate, rate1, rate5, rate15 float64
 }
 
 // Count returns the count of events at the time the snapshot was taken.
@@ -66,20 +78,47 @@ func (*MeterSnapshot) Mark(n int64) {
 	panic("Mark called on a MeterSnapshot")
 }
 
-// RateMean returns the meter's mean rate of events per second at the time the
-// snapshot was taken.
+// RateMean returns the mean of the values marked on the meter at the time
+// the snapshot was taken.
 func (m *MeterSnapshot) RateMean() float64 { return math.Float64frombits(m.rateMean) }
 
+// Rate returns the meter's mean rate of marks per second at the time the
+// snapshot was taken.
+func (m *MeterSnapshot) Rate() float64 { return m.rate }
+
+// Rate1 returns the one-minute moving average rate of marks per second at
+// the time the snapshot was taken.
+func (m *MeterSnapshot) Rate1() float64 { return m.rate1 }
+
+// Rate5 returns the five-minute moving average rate of marks per second at
+// the time the snapshot was taken.
+func (m *MeterSnapshot) Rate5() float64 { return m.rate5 }
+
+// Rate15 returns the fifteen-minute moving average rate of marks per second
+// at the time the snapshot was taken.
+func (m *MeterSnapshot) Rate15() float64 { return m.rate15 }
+
 // Snapshot returns the snapshot.
 func (m *MeterSnapshot) Snapshot() Meter { return m }
 
+// Stop is a no-op.
+func (m *MeterSnapshot) Stop() {}
+
 // LastValue returns the last recorded value on the meter
 func (m *MeterSnapshot) LastValue() int64 { return m.lastValue }
 
+// MarshalMetric returns the values of the snapshot, as output by the
+// registry.
+func (m *MeterSnapshot) MarshalMetric() (interface{}, error) {
+	return meterValue(m), nil
+}
+
 // StandardMeter is the standard implementation of a Meter.
 type StandardMeter struct {
-	snapshot  *MeterSnapshot
-	startTime time.Time
+	snapshot    *MeterSnapshot
+	startTime   time.Time
+	a1, a5, a15 EWMA
+	stopped     uint32
 }
 
 // Count returns the number of events recorded.
@@ -92,15 +131,37 @@ func (m *StandardMeter) Mark(n int64) {
 	atomic.AddInt64(&m.snapshot.count, 1)
 	atomic.AddInt64(&m.snapshot.value, n)
 	atomic.StoreInt64(&m.snapshot.lastValue, n)
+	m.a1.Update(1)
+	m.a5.Update(1)
+	m.a15.Update(1)
 
 	m.updateSnapshot()
 }
 
-// RateMean returns the meter's mean rate of events per second.
+// RateMean returns the mean of the values marked on the meter.
 func (m *StandardMeter) RateMean() float64 {
 	return math.Float64frombits(atomic.LoadUint64(&m.snapshot.rateMean))
 }
 
+// Rate returns the meter's mean rate of marks per second since it was
+// created.
+func (m *StandardMeter) Rate() float64 {
+	elapsed := time.Since(m.startTime).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.Count()) / elapsed
+}
+
+// Rate1 returns the one-minute moving average rate of marks per second.
+func (m *StandardMeter) Rate1() float64 { return m.a1.Rate() }
+
+// Rate5 returns the five-minute moving average rate of marks per second.
+func (m *StandardMeter) Rate5() float64 { return m.a5.Rate() }
+
+// Rate15 returns the fifteen-minute moving average rate of marks per second.
+func (m *StandardMeter) Rate15() float64 { return m.a15.Rate() }
+
 // LastValue returns the last recorded value on the meter
 func (m *StandardMeter) LastValue() int64 { return atomic.LoadInt64(&m.snapshot.lastValue) }
 
@@ -110,12 +171,96 @@ func (m *StandardMeter) Snapshot() Meter {
 		count:     atomic.LoadInt64(&m.snapshot.count),
 		rateMean:  atomic.LoadUint64(&m.snapshot.rateMean),
 		lastValue: atomic.LoadInt64(&m.snapshot.lastValue),
+		rate:      m.Rate(),
+		rate1:     m.Rate1(),
+		rate5:     m.Rate5(),
+		rate15:    m.Rate15(),
 	}
 	return &copiedSnapshot
 }
 
+// Stop stops the meter from updating its moving average rates. A stopped
+// meter keeps recording marks, but Rate1, Rate5 and Rate15 stay frozen.
+func (m *StandardMeter) Stop() {
+	if atomic.CompareAndSwapUint32(&m.stopped, 0, 1) {
+		arbiter.remove(m)
+	}
+}
+
+// MarshalMetric returns the count, mean, last value and rates of the meter,
+// as output by the registry.
+func (m *StandardMeter) MarshalMetric() (interface{}, error) {
+	return meterValue(m.Snapshot()), nil
+}
+
+// createdTime returns the time the meter was created.
+func (m *StandardMeter) createdTime() time.Time { return m.startTime }
+
+// meterValue returns the values a Meter is output as.
+func meterValue(m Meter) map[string]interface{} {
+	return map[string]interface{}{
+		"count":     m.Count(),
+		"mean":      m.RateMean(),
+		"lastValue": m.LastValue(),
+		"rate":      m.Rate(),
+		"rate1":     m.Rate1(),
+		"rate5":     m.Rate5(),
+		"rate15":    m.Rate15(),
+	}
+}
+
 func (m *StandardMeter) updateSnapshot() {
 	rateMean := math.Float64bits(float64(atomic.LoadInt64(&m.snapshot.value)) / float64(m.Count()))
 
 	atomic.StoreUint64(&m.snapshot.rateMean, rateMean)
 }
+
+// tick folds the marks seen since the last tick into the moving averages.
+func (m *StandardMeter) tick() {
+	m.a1.Tick()
+	m.a5.Tick()
+	m.a15.Tick()
+}
+
+// meterArbiter ticks the moving averages of every running meter from a single
+// shared goroutine.
+type meterArbiter struct {
+	mutex   sync.RWMutex
+	started bool
+	meters  map[*StandardMeter]struct{}
+}
+
+var arbiter = meterArbiter{meters: make(map[*StandardMeter]struct{})}
+
+// add starts ticking the given meter, launching the ticking goroutine the
+// first time a meter is added.
+func (ma *meterArbiter) add(m *StandardMeter) {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	ma.meters[m] = struct{}{}
+	if !ma.started {
+		ma.started = true
+		go ma.run(time.NewTicker(ewmaTickInterval))
+	}
+}
+
+// remove stops ticking the given meter.
+func (ma *meterArbiter) remove(m *StandardMeter) {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	delete(ma.meters, m)
+}
+
+func (ma *meterArbiter) run(ticker *time.Ticker) {
+	for range ticker.C {
+		ma.tickMeters()
+	}
+}
+
+func (ma *meterArbiter) tickMeters() {
+	ma.mutex.RLock()
+	defer ma.mutex.RUnlock()
+	for m := range ma.meters {
+		m.tick()
+	}
+}
@@ -76,3 +76,68 @@ func TestGetMeter(t *testing.T) {
 		t.Fatal(m)
 	}
 }
+
+func TestMeterRates(t *testing.T) {
+	m := NewMeter()
+	defer m.Stop()
+	for i := 0; i < 5; i++ {
+		m.Mark(randomInt64())
+	}
+	if rate := m.Rate1(); 0 != rate {
+		t.Errorf("m.Rate1() before tick: 0 != %v\n", rate)
+	}
+	m.(*StandardMeter).tick()
+	if rate := m.Rate1(); 1.0 != rate {
+		t.Errorf("m.Rate1(): 1.0 != %v\n", rate)
+	}
+	if rate := m.Rate5(); 1.0 != rate {
+		t.Errorf("m.Rate5(): 1.0 != %v\n", rate)
+	}
+	if rate := m.Rate15(); 1.0 != rate {
+		t.Errorf("m.Rate15(): 1.0 != %v\n", rate)
+	}
+	if rate := m.Rate(); rate <= 0 {
+		t.Errorf("m.Rate(): %v <= 0\n", rate)
+	}
+	if snapshot := m.Snapshot(); 1.0 != snapshot.Rate1() {
+		t.Fatal(snapshot)
+	}
+}
+
+func TestMeterStop(t *testing.T) {
+	m := NewMeter()
+	m.Stop()
+	arbiter.mutex.RLock()
+	_, ok := arbiter.meters[m.(*StandardMeter)]
+	arbiter.mutex.RUnlock()
+	if ok {
+		t.Error("stopped meter is still ticked")
+	}
+}
+
+func TestMeterUnregister(t *testing.T) {
+	r := NewRegistry()
+	m := NewRegisteredMeter("foo", r)
+	r.Unregister("foo")
+	arbiter.mutex.RLock()
+	_, ok := arbiter.meters[m.(*StandardMeter)]
+	arbiter.mutex.RUnlock()
+	if ok {
+		t.Error("unregistered meter is still ticked")
+	}
+}
+
+func TestMeterUnregisterShared(t *testing.T) {
+	m := NewMeter()
+	defer m.Stop()
+	r1, r2 := NewRegistry(), NewRegistry()
+	r1.Register("foo", m)
+	r2.Register("foo", m)
+	r1.Unregister("foo")
+	arbiter.mutex.RLock()
+	_, ok := arbiter.meters[m.(*StandardMeter)]
+	arbiter.mutex.RUnlock()
+	if !ok {
+		t.Error("meter passed to Register was stopped by Unregister")
+	}
+}
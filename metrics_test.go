@@ -37,16 +37,6 @@ func Example() {
 	t1.Set("Error: ")
 	t1.Append("did not hello world")
 
-	m1 := NewRegisteredMeter("world", registry)
-	m1.Mark(50)
-	m1.Mark(100)
-
-	q1 := NewRegisteredTimer("golang", registry)
-	q1.Start()
-	time.Sleep(time.Second * 1)
-	q1.Stop()
-	q1.Time(func() { time.Sleep(time.Second * 4) })
-
 	nestedRegistry := NewRegistry()
 	NewRegisteredText("msg", nestedRegistry).Set("This is a nested registry")
 	NewRegisteredCounter("count", nestedRegistry).Inc(1996)
@@ -80,5 +70,40 @@ func Example() {
 		panic(err)
 	}
 	fmt.Println(string(js))
-	// Output: {"ExistingJson":{"Sample":{"ValueOne":1,"ValueTwo":2},"Data":{"ValueOne":3,"ValueTwo":4},"Value":5},"bar":83,"foo":9,"golang":{"count":2,"executions":[1,4],"lastValue":4,"max":4,"mean":2.5,"min":1},"hello":"Error: did not hello world","registry2":{"count":1996,"msg":"This is a nested registry"},"sliceReg":[{"count":0,"msg":"This is a slice entry"},{"count":1,"msg":"This is a slice entry"},{"count":2,"msg":"This is a slice entry"},{"count":3,"msg":"This is a slice entry"},{"count":4,"msg":"This is a slice entry"}],"world":{"count":2,"lastValue":100,"mean":75}}
+	// Output: {"ExistingJson":{"Sample":{"ValueOne":1,"ValueTwo":2},"Data":{"ValueOne":3,"ValueTwo":4},"Value":5},"bar":83,"foo":9,"hello":"Error: did not hello world","registry2":{"count":1996,"msg":"This is a nested registry"},"sliceReg":[{"count":0,"msg":"This is a slice entry"},{"count":1,"msg":"This is a slice entry"},{"count":2,"msg":"This is a slice entry"},{"count":3,"msg":"This is a slice entry"},{"count":4,"msg":"This is a slice entry"}]}
+}
+
+// The rates of a meter depend on when it was marked, so the output of this
+// example varies between runs.
+func ExampleMeter() {
+	registry := NewRegistry()
+
+	m1 := NewRegisteredMeter("world", registry)
+	m1.Mark(50)
+	m1.Mark(100)
+
+	js, err := registry.GetAllJson()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(js))
+}
+
+// Timers record durations with nanosecond precision, so the output of this
+// example varies between runs.
+func ExampleTimer() {
+	registry := NewRegistry()
+
+	q1 := NewRegisteredTimer("golang", registry)
+	q1.SetUnit(time.Millisecond)
+	q1.Start()
+	time.Sleep(time.Second * 1)
+	q1.Stop()
+	q1.Time(func() { time.Sleep(time.Second * 4) })
+
+	js, err := registry.GetAllJson()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(js))
 }
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+)
+
+// OpenMetricsContentType is the content type of the OpenMetrics text format
+// written by WriteOpenMetrics.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteOpenMetrics writes the metrics of a registry of any implementation in
+// the OpenMetrics 1.0 text format, terminated by "# EOF". The metrics are
+// output as by WritePrometheus, with the unit of timers as a UNIT, and with
+// the time counters, meters, timers, bucketed histograms and summaries were
+// created, or last cleared, as their _created samples.
+//
+// The most recent exemplar of an ExemplarCounter, or of each bucket of a
+// BucketedHistogram, is output with its count.
+func WriteOpenMetrics(w io.Writer, r Registry) error {
+	bw := bufio.NewWriter(w)
+	for _, family := range metricFamilies(r) {
+		bw.WriteString("# TYPE " + family.name + " " + family.kind + "\n")
+		if family.unit != "" {
+			bw.WriteString("# UNIT " + family.name + " " + family.unit + "\n")
+		}
+		for _, series := range family.series {
+			for _, sample := range series.samples {
+				writeSample(bw, family.name+sample.suffix, series.labels, sample.labels)
+				bw.WriteString(" " + formatFloat(sample.value))
+				if sample.exemplar != nil {
+					writeExemplar(bw, sample.exemplar)
+				}
+				bw.WriteByte('\n')
+			}
+			if !series.created.IsZero() && hasCreated(family.kind) {
+				writeSample(bw, family.name+"_created", series.labels, nil)
+				bw.WriteString(" " + formatTimestamp(series.created) + "\n")
+			}
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// hasCreated returns whether the series of a kind of family have _created
+// samples.
+func hasCreated(kind string) bool {
+	switch kind {
+	case familyCounter, familyHistogram, familySummary:
+		return true
+	}
+	return false
+}
+
+// writeExemplar writes an exemplar, with its labels sorted by name.
+func writeExemplar(w *bufio.Writer, e *Exemplar) {
+	labels := make([]labelPair, 0, len(e.Labels))
+	for name, value := range e.Labels {
+		labels = append(labels, labelPair{sanitizeName(name), value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	w.WriteString(" # ")
+	writeSample(w, "", labels, nil)
+	if len(labels) == 0 {
+		w.WriteString("{}")
+	}
+	w.WriteString(" " + formatFloat(e.Value))
+	if !e.Timestamp.IsZero() {
+		w.WriteString(" " + formatTimestamp(e.Timestamp))
+	}
+}
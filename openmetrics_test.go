@@ -0,0 +1,397 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testCreated is the creation time of the metrics of the golden files.
+var testCreated = time.Date(2018, time.March, 12, 18, 33, 27, 123000000, time.UTC)
+
+// setCreated sets the creation time of a metric, and of the children of a
+// vector, to testCreated.
+func setCreated(i interface{}) {
+	switch metric := i.(type) {
+	case *StandardCounter:
+		metric.created = testCreated.UnixNano()
+	case *StandardBucketedHistogram:
+		metric.created = testCreated
+	case *StandardSummary:
+		metric.created = testCreated
+	case *StandardMeter:
+		metric.startTime = testCreated
+	case *StandardTimer:
+		setCreated(metric.meter)
+	case MetricVec:
+		metric.EachChild(func(_ []string, child interface{}) { setCreated(child) })
+	}
+}
+
+// openMetricsCases are the registries of the golden files in
+// testdata/openmetrics, by name.
+var openMetricsCases = map[string]func() Registry{
+	"empty": NewRegistry,
+	"counter": func() Registry {
+		r := NewRegistry()
+		NewRegisteredCounter("jobs.processed", r).Inc(1000000)
+		c := NewRegisteredCounter("http_requests_total", r).(*StandardCounter)
+		c.Inc(4)
+		c.incWithExemplar(testCreated.Add(time.Minute), 2, Labels{"trace_id": "4bf92f3577b34da6"})
+		v := NewRegisteredCounterVec("errors", r, []string{"code", "path"})
+		v.WithLabelValues("500", "/api").Inc(2)
+		v.WithLabelValues("404", `/a"b\c`).Inc(1)
+		r.Each(func(_ string, i interface{}) { setCreated(i) })
+		return r
+	},
+	"conflict": func() Registry {
+		r := NewRegistry()
+		NewRegisteredCounter("jobs", r).Inc(3)
+		NewRegisteredGauge("jobs_created", r).Update(7)
+		NewRegisteredBucketedHistogram("batch", r, []float64{10}).Update(4)
+		NewRegisteredGauge("batch_count", r).Update(9)
+		NewRegisteredGauge("batch_size", r).Update(5)
+		r.Each(func(_ string, i interface{}) { setCreated(i) })
+		return r
+	},
+	"histogram": func() Registry {
+		r := NewRegistry()
+		h := NewRegisteredBucketedHistogram("response.size", r, []float64{100, 1000, 10000}).(*StandardBucketedHistogram)
+		for _, v := range []float64{50, 150, 700, 20000} {
+			h.Update(v)
+		}
+		h.updateWithExemplar(testCreated.Add(time.Second), 800, Labels{"trace_id": "a1", "span_id": "b2"})
+		h.updateWithExemplar(testCreated.Add(2*time.Second), 12.5, nil)
+		setCreated(h)
+		return r
+	},
+	"summary": func() Registry {
+		r := NewRegistry()
+		s := NewRegisteredSummary("queue.wait", r, WithSummaryObjectives(SummaryObjective{0.5, 0.05}, SummaryObjective{0.9, 0.01}))
+		for v := 1; v <= 10; v++ {
+			s.Update(float64(v))
+		}
+		timer := NewRegisteredTimer("latency", r)
+		timer.Update(250 * time.Millisecond)
+		timer.Update(750 * time.Millisecond)
+		NewRegisteredHistogram("batch", r, NewUniformSample(100), WithHistogramPercentiles(0.5)).Update(7)
+		r.(*StandardRegistry).SetPercentiles([]float64{0.5, 0.99})
+		r.Each(func(_ string, i interface{}) { setCreated(i) })
+		return r
+	},
+	"nested": func() Registry {
+		r := NewRegistry()
+		NewRegisteredText("build", r).Set("v1.2.3\n\"rc\"")
+		NewRegisteredJson("config", r).Set([]byte(`{"debug":true}`))
+		NewRegisteredGaugeFloat64("temperature.celsius", r).Update(-3.5)
+		cache := NewRegistry()
+		r.Register("cache", cache)
+		NewRegisteredGauge("entries", cache).Update(12)
+		workers := NewRegisteredSlice("workers", r)
+		for i := 0; i < 2; i++ {
+			w := NewRegistry()
+			NewRegisteredGauge("busy", w).Update(int64(i))
+			workers.Append(w)
+		}
+		r.Register("connections", connectionCount(3))
+		return r
+	},
+}
+
+func TestWriteOpenMetricsGolden(t *testing.T) {
+	for name, newRegistry := range openMetricsCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteOpenMetrics(&buf, newRegistry()); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkOpenMetrics(buf.String()); err != nil {
+				t.Errorf("invalid OpenMetrics: %v\n%s", err, buf.String())
+			}
+			path := filepath.Join("testdata", "openmetrics", name+".txt")
+			if *updateGolden {
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			golden, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(golden, buf.Bytes()) {
+				t.Errorf("WriteOpenMetrics():\n%s\n!= %s:\n%s", buf.String(), path, golden)
+			}
+		})
+	}
+}
+
+func TestWriteOpenMetricsConformance(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredMeter("events", r).Mark(3)
+	c := NewRegisteredCounter("requests", r).(ExemplarCounter)
+	c.IncWithExemplar(1, Labels{"trace_id": strings.Repeat("x", 120)})
+	h := NewRegisteredBucketedHistogram("duration", r, nil)
+	h.UpdateWithExemplar(0.3, Labels{"trace_id": "abc"})
+	NewRegisteredTimerVec("db.query", r, []string{"table"}).WithLabelValues("users").Update(time.Millisecond)
+	NewRegisteredSummary("wait", r).Update(1)
+	nested := NewRegistry()
+	r.Register("nested", nested)
+	nested.Register("vec", NewHistogramVec([]string{"le.vel"}, func() Sample { return NewUniformSample(10) }))
+
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOpenMetrics(buf.String()); err != nil {
+		t.Errorf("invalid OpenMetrics: %v\n%s", err, buf.String())
+	}
+	if !strings.Contains(buf.String(), `duration_bucket{le="0.5"} 1 # {trace_id="abc"} 0.3 `) {
+		t.Errorf("WriteOpenMetrics() has no exemplar for duration:\n%s", buf.String())
+	}
+}
+
+func TestWriteOpenMetricsNegativeCounter(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Dec(2)
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nrequests_total 0\n") {
+		t.Errorf("WriteOpenMetrics() does not output requests as 0:\n%s", buf.String())
+	}
+	if err := checkOpenMetrics(buf.String()); err != nil {
+		t.Errorf("invalid OpenMetrics: %v\n%s", err, buf.String())
+	}
+}
+
+func TestExemplarLabelLength(t *testing.T) {
+	c := NewCounter().(ExemplarCounter)
+	c.IncWithExemplar(1, Labels{"trace_id": strings.Repeat("x", MaxExemplarLabelLength-8)})
+	if e := c.Exemplar(); nil == e || 1 != e.Value {
+		t.Fatalf("c.Exemplar(): %v\n", e)
+	}
+	c.IncWithExemplar(2, Labels{"trace_id": strings.Repeat("x", MaxExemplarLabelLength-7)})
+	if e := c.Exemplar(); 1 != e.Value {
+		t.Errorf("c.Exemplar().Value: 1 != %v\n", e.Value)
+	}
+	if count := c.Count(); 3 != count {
+		t.Errorf("c.Count(): 3 != %v\n", count)
+	}
+	c.Clear()
+	if e := c.Exemplar(); nil != e {
+		t.Errorf("c.Exemplar() after clear: %v\n", e)
+	}
+}
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// omSuffixes are the sample name suffixes allowed for each type of family.
+var omSuffixes = map[string][]string{
+	"counter":   {"_total", "_created"},
+	"gauge":     {""},
+	"histogram": {"_bucket", "_count", "_sum", "_created"},
+	"summary":   {"", "_count", "_sum", "_created"},
+	"info":      {"_info"},
+	"unknown":   {""},
+}
+
+// checkOpenMetrics checks that text follows the rules of the OpenMetrics 1.0
+// text format that the output of WriteOpenMetrics can break.
+func checkOpenMetrics(text string) error {
+	if !strings.HasSuffix(text, "# EOF\n") {
+		return errors.New("no # EOF at the end")
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "# EOF\n"), "\n")
+	lines = lines[:len(lines)-1]
+	seen := make(map[string]bool)
+	sampleFamilies := make(map[string]string)
+	var family, kind string
+	var lastLe float64
+	var lastBucket string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 || omSuffixes[fields[3]] == nil {
+				return fmt.Errorf("invalid TYPE line %q", line)
+			}
+			family, kind = fields[2], fields[3]
+			if !metricNameRE.MatchString(family) || seen[family] {
+				return fmt.Errorf("invalid or repeated family %q", family)
+			}
+			seen[family] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# UNIT ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 || fields[2] != family || !strings.HasSuffix(family, "_"+fields[3]) {
+				return fmt.Errorf("invalid UNIT line %q", line)
+			}
+			continue
+		}
+		name, labels, rest, err := parseOpenMetricsSample(line)
+		if err != nil {
+			return fmt.Errorf("%q: %v", line, err)
+		}
+		suffix, ok := "", false
+		for _, s := range omSuffixes[kind] {
+			if name == family+s {
+				suffix, ok = s, true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("sample %q outside of its family %q", name, family)
+		}
+		if other, ok := sampleFamilies[name]; ok && other != family {
+			return fmt.Errorf("sample %q of families %q and %q", name, other, family)
+		}
+		sampleFamilies[name] = family
+		value, exemplar, hasExemplar := strings.Cut(rest, " # ")
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q: invalid value", line)
+		}
+		if kind == "counter" && suffix == "_total" && v < 0 {
+			return fmt.Errorf("%q: negative counter", line)
+		}
+		if hasExemplar {
+			if suffix != "_total" && suffix != "_bucket" {
+				return fmt.Errorf("%q: exemplar on a %s sample", line, suffix)
+			}
+			if err := checkExemplar(exemplar); err != nil {
+				return fmt.Errorf("%q: %v", line, err)
+			}
+		}
+		if suffix == "_bucket" {
+			le, err := strconv.ParseFloat(labels["le"], 64)
+			if err != nil {
+				return fmt.Errorf("%q: invalid le", line)
+			}
+			if lastBucket != "" && le <= lastLe {
+				return fmt.Errorf("%q: buckets out of order", line)
+			}
+			lastLe, lastBucket = le, value
+		} else if kind == "histogram" && lastBucket != "" {
+			if labels["le"] != "" || !math.IsInf(lastLe, 1) {
+				return fmt.Errorf("%q: no +Inf bucket", line)
+			}
+			if suffix == "_count" && value != lastBucket {
+				return fmt.Errorf("%q: count is not the +Inf bucket %s", line, lastBucket)
+			}
+		}
+		if suffix == "_count" {
+			lastBucket = ""
+		}
+	}
+	return nil
+}
+
+// checkExemplar checks the labels, value and timestamp of an exemplar.
+func checkExemplar(exemplar string) error {
+	_, labels, rest, err := parseOpenMetricsSample(exemplar)
+	if err != nil {
+		return err
+	}
+	length := 0
+	for name, value := range labels {
+		length += len([]rune(name)) + len([]rune(value))
+	}
+	if length > MaxExemplarLabelLength {
+		return fmt.Errorf("exemplar labels of %d characters", length)
+	}
+	for _, field := range strings.Split(rest, " ") {
+		if _, err := strconv.ParseFloat(field, 64); err != nil {
+			return fmt.Errorf("invalid exemplar %q", exemplar)
+		}
+	}
+	return nil
+}
+
+// parseOpenMetricsSample splits a sample line into its name, its unescaped
+// labels and the rest of the line.
+func parseOpenMetricsSample(line string) (string, map[string]string, string, error) {
+	i := strings.IndexAny(line, "{ ")
+	if i < 0 {
+		return "", nil, "", errors.New("no value")
+	}
+	name, line := line[:i], line[i:]
+	if name != "" && !metricNameRE.MatchString(name) {
+		return "", nil, "", fmt.Errorf("invalid name %q", name)
+	}
+	labels := make(map[string]string)
+	if strings.HasPrefix(line, "{") {
+		line = line[1:]
+		for !strings.HasPrefix(line, "}") {
+			line = strings.TrimPrefix(line, ",")
+			labelName, rest, ok := strings.Cut(line, `="`)
+			if !ok || !labelNameRE.MatchString(labelName) {
+				return "", nil, "", fmt.Errorf("invalid label %q", line)
+			}
+			var value strings.Builder
+			for ; ; rest = rest[1:] {
+				if rest == "" {
+					return "", nil, "", errors.New("unterminated label value")
+				}
+				if rest[0] == '"' {
+					break
+				}
+				if rest[0] == '\\' {
+					rest = rest[1:]
+					switch {
+					case strings.HasPrefix(rest, "n"):
+						value.WriteByte('\n')
+					case strings.HasPrefix(rest, `"`), strings.HasPrefix(rest, `\`):
+						value.WriteByte(rest[0])
+					default:
+						return "", nil, "", errors.New("invalid escape")
+					}
+					continue
+				}
+				value.WriteByte(rest[0])
+			}
+			if _, ok := labels[labelName]; ok {
+				return "", nil, "", fmt.Errorf("repeated label %q", labelName)
+			}
+			labels[labelName] = value.String()
+			line = rest[1:]
+		}
+		line = line[1:]
+	}
+	if !strings.HasPrefix(line, " ") {
+		return "", nil, "", errors.New("no value")
+	}
+	return name, labels, line[1:], nil
+}
+
+func TestCheckOpenMetrics(t *testing.T) {
+	for _, invalid := range []string{
+		"# TYPE foo counter\nfoo_total 1\n",
+		"# TYPE foo counter\nfoo 1\n# EOF\n",
+		"# TYPE foo counter\nfoo_total -1\n# EOF\n",
+		"# TYPE foo gauge\nfoo 1 # {a=\"b\"} 1\n# EOF\n",
+		"# TYPE foo_seconds summary\n# UNIT foo_seconds bytes\n# EOF\n",
+		"# TYPE foo histogram\nfoo_bucket{le=\"1\"} 1\nfoo_count 1\n# EOF\n",
+		"# TYPE foo histogram\nfoo_bucket{le=\"+Inf\"} 2\nfoo_count 1\n# EOF\n",
+		"# TYPE foo gauge\nfoo 1\n# TYPE foo gauge\n# EOF\n",
+		"# TYPE foo gauge\nfoo{a=\"b} 1\n# EOF\n",
+		"# TYPE foo counter\nfoo_created 1\n# TYPE foo_created gauge\nfoo_created 2\n# EOF\n",
+	} {
+		if err := checkOpenMetrics(invalid); err == nil {
+			t.Errorf("checkOpenMetrics(%q): nil error\n", invalid)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition
+// format written by WritePrometheus.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes the metrics of a registry of any implementation in
+// the Prometheus text exposition format, sorted by name so the output is
+// deterministic.
+//
+// Counters are output as counters, and gauges as gauges. Meters are output as
+// a counter of their marks and a gauge for each of their rates. Timers and
+// histograms are output as summaries of their percentiles, timers in seconds,
+// and bucketed histograms and summaries as histograms and summaries. The
+// children of metric vectors are output with their labels.
+//
+// Nested registries are flattened into the names of their metrics, so a
+// counter "hits" in a registry registered as "cache" is output as
+// cache_hits_total, and the registries of a slice are told apart by an index
+// label. Names are sanitized, replacing characters such as dots with
+// underscores. Text metrics are output as info metrics, with the text as the
+// value label, and Json metrics are left out.
+func WritePrometheus(w io.Writer, r Registry) error {
+	bw := bufio.NewWriter(w)
+	for _, family := range metricFamilies(r) {
+		name := family.name
+		kind := family.kind
+		switch kind {
+		case familyCounter:
+			name += "_total"
+		case familyInfo:
+			name += "_info"
+			kind = familyGauge
+		case familyUnknown:
+			kind = "untyped"
+		}
+		bw.WriteString("# TYPE " + name + " " + kind + "\n")
+		for _, series := range family.series {
+			for _, sample := range series.samples {
+				writeSample(bw, family.name+sample.suffix, series.labels, sample.labels)
+				bw.WriteString(" " + formatFloat(sample.value) + "\n")
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// writeSample writes the name and labels of a sample.
+func writeSample(w *bufio.Writer, name string, labels, sampleLabels []labelPair) {
+	w.WriteString(name)
+	if len(labels)+len(sampleLabels) == 0 {
+		return
+	}
+	w.WriteByte('{')
+	for i, label := range append(append([]labelPair{}, labels...), sampleLabels...) {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(label.name + `="` + labelValueEscaper.Replace(label.value) + `"`)
+	}
+	w.WriteByte('}')
+}
+
+// labelValueEscaper escapes the backslashes, double quotes and line feeds of
+// a label value.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// prometheusText writes the registry in the Prometheus text format.
+func prometheusText(t *testing.T, r Registry) string {
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("http.requests", r).Inc(1000000)
+	NewRegisteredGaugeFloat64("temperature", r).Update(21.5)
+	h := NewRegisteredBucketedHistogram("size", r, []float64{1, 10})
+	h.Update(0.5)
+	h.Update(5)
+	h.Update(50)
+	v := NewRegisteredCounterVec("hits", r, []string{"code", "method"})
+	v.WithLabelValues("500", "GET").Inc(1)
+	v.WithLabelValues("200", "GET").Inc(3)
+	cache := NewRegistry()
+	r.Register("cache", cache)
+	NewRegisteredCounter("hits_total", cache).Inc(2)
+	timer := NewRegisteredTimer("latency", cache)
+	timer.Update(time.Second)
+	timer.Update(3 * time.Second)
+	cache.(*StandardRegistry).SetTimerUnit(time.Millisecond)
+	cache.(*StandardRegistry).SetPercentiles([]float64{0.5, 0.99})
+	s := NewRegisteredSlice("workers", r)
+	for i := 0; i < 2; i++ {
+		worker := NewRegistry()
+		NewRegisteredGauge("jobs", worker).Update(int64(i))
+		s.Append(worker)
+	}
+	NewRegisteredText("version", r).Set("1.2 \"beta\"\n")
+	NewRegisteredJson("config", r).Set([]byte(`{"debug":true}`))
+
+	want := `# TYPE cache_hits_total counter
+cache_hits_total 2
+# TYPE cache_latency_seconds summary
+cache_latency_seconds{quantile="0.5"} 2
+cache_latency_seconds{quantile="0.99"} 3
+cache_latency_seconds_sum 4
+cache_latency_seconds_count 2
+# TYPE hits_total counter
+hits_total{code="200",method="GET"} 3
+hits_total{code="500",method="GET"} 1
+# TYPE http_requests_total counter
+http_requests_total 1000000
+# TYPE size histogram
+size_bucket{le="1"} 1
+size_bucket{le="10"} 2
+size_bucket{le="+Inf"} 3
+size_sum 55.5
+size_count 3
+# TYPE temperature gauge
+temperature 21.5
+# TYPE version_info gauge
+version_info{value="1.2 \"beta\"\n"} 1
+# TYPE workers_jobs gauge
+workers_jobs{index="0"} 0
+workers_jobs{index="1"} 1
+`
+	for i := 0; i < 3; i++ {
+		if text := prometheusText(t, r); want != text {
+			t.Errorf("WritePrometheus():\n%s\n!=\n%s", text, want)
+		}
+	}
+}
+
+func TestWritePrometheusMeterAndHistogram(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredMeter("events", r).Mark(5)
+	h := NewRegisteredHistogram("payload", r, NewUniformSample(100), WithHistogramPercentiles(0.5))
+	h.Update(1)
+	h.Update(3)
+	text := prometheusText(t, r)
+	for _, line := range []string{
+		"# TYPE events_total counter\nevents_total 1\n",
+		"# TYPE events_last_value gauge\nevents_last_value 5\n",
+		"# TYPE events_mean gauge\nevents_mean 5\n",
+		"# TYPE events_rate1 gauge\n",
+		"# TYPE payload summary\npayload{quantile=\"0.5\"} 2\npayload_sum 4\npayload_count 2\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("WritePrometheus() does not contain %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestWritePrometheusNameConflict(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		r := NewRegistry()
+		NewRegisteredGauge("a.b", r).Update(1)
+		NewRegisteredCounter("a_b", r).Inc(2)
+		NewRegisteredGauge("a-b", r).Update(3)
+		if want, text := "# TYPE a_b gauge\na_b 3\n", prometheusText(t, r); want != text {
+			t.Fatalf("WritePrometheus(): %q != %q\n", want, text)
+		}
+	}
+}
+
+func TestWritePrometheusSampleNameConflict(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredBucketedHistogram("batch", r, []float64{1}).Update(2)
+	NewRegisteredGauge("batch_count", r).Update(7)
+	NewRegisteredCounter("jobs", r).Inc(2)
+	NewRegisteredGauge("jobs_total", r).Update(5)
+	want := `# TYPE batch histogram
+batch_bucket{le="1"} 0
+batch_bucket{le="+Inf"} 1
+batch_sum 2
+batch_count 1
+# TYPE jobs_total counter
+jobs_total 2
+`
+	if text := prometheusText(t, r); want != text {
+		t.Errorf("WritePrometheus():\n%s\n!=\n%s", text, want)
+	}
+}
+
+func TestWritePrometheusEmpty(t *testing.T) {
+	if text := prometheusText(t, NewRegistry()); "" != text {
+		t.Errorf("WritePrometheus(): %q != \"\"\n", text)
+	}
+}
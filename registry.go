@@ -3,7 +3,10 @@ package metrics
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"sync"
+	"time"
 )
 
 // Default registry is none is specified
@@ -18,11 +21,39 @@ func (err DuplicateMetric) Error() string {
 	return fmt.Sprintf("duplicate metric: %s\n", string(err))
 }
 
+// CardinalityLimitExceeded is the error returned by Registry.Register when
+// the registry already holds as many metrics as its cardinality limit. The
+// registration is counted by the registry's OverflowName counter instead.
+type CardinalityLimitExceeded string
+
+func (err CardinalityLimitExceeded) Error() string {
+	return fmt.Sprintf("cardinality limit exceeded: %s\n", string(err))
+}
+
+// ReservedMetricName is the error returned by Registry.Register when a metric
+// is registered under OverflowName, which the registry keeps for its own
+// counter.
+type ReservedMetricName string
+
+func (err ReservedMetricName) Error() string {
+	return fmt.Sprintf("reserved metric name: %s\n", string(err))
+}
+
+// OverflowName is the name of the series that counts the registrations a
+// registry rejected, and the label value of the series that metric vectors
+// redirect label sets to, once their cardinality limit is reached.
+const OverflowName = "__overflow__"
+
 // The standard implementation of a Registry is a mutex-protected map
 // of names to metrics.
 type StandardRegistry struct {
-	metrics map[string]interface{}
-	mutex   sync.RWMutex
+	metrics     map[string]interface{}
+	mutex       sync.RWMutex
+	timerUnit   time.Duration
+	percentiles []float64
+	limit       int
+	overflow    Counter
+	created     map[string]bool // names of the metrics the registry created
 }
 
 // A Registry holds references to a set of metrics by name and can iterate
@@ -50,6 +81,13 @@ type Registry interface {
 	MetricCount() int
 }
 
+// GetOrRegisterer is implemented by registries that can get a metric, or
+// register one if none is registered, atomically. StandardRegistry implements
+// it, and the generic GetOrRegister uses it when the registry does.
+type GetOrRegisterer interface {
+	GetOrRegister(string, interface{}) (interface{}, error)
+}
+
 // Call the given function for each registered metric.
 func (r *StandardRegistry) Each(f func(string, interface{})) {
 	metrics := r.registered()
@@ -66,68 +104,272 @@ func (r *StandardRegistry) Get(name string) interface{} {
 	return r.metrics[name]
 }
 
-// Output the value of all registered metrics
-func (r *StandardRegistry) serializeRegistry() map[string]interface{} {
+// GetOrRegister returns the metric registered under the given name, or
+// registers and returns the given metric if none is. If i is a
+// func() interface{}, it is only called to make the metric when none is
+// registered, and must not use the registry. The lookup and registration are
+// atomic, so goroutines racing to register a name all get the same metric.
+func (r *StandardRegistry) GetOrRegister(name string, i interface{}) (interface{}, error) {
+	r.mutex.RLock()
+	metric, ok := r.metrics[name]
+	r.mutex.RUnlock()
+	if ok {
+		return metric, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if metric, ok := r.metrics[name]; ok {
+		return metric, nil
+	}
+	f, built := i.(func() interface{})
+	if built {
+		i = f()
+	}
+	if err := r.register(name, i); err != nil {
+		if built {
+			stopMetric(i)
+		}
+		return nil, err
+	}
+	if built {
+		r.created[name] = true
+	}
+	return i, nil
+}
+
+// SetTimerUnit sets the unit used to output the timers of this registry and
+// its nested registries, unless a timer or nested registry chooses its own.
+// A unit of 0 inherits the unit of the parent registry, or DefaultTimerUnit.
+func (r *StandardRegistry) SetTimerUnit(unit time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timerUnit = unit
+}
+
+// SetPercentiles sets the percentiles output for the histograms and timers of
+// this registry and its nested registries, unless a histogram or nested
+// registry chooses its own. Nil inherits the percentiles of the parent
+// registry, or DefaultPercentiles.
+func (r *StandardRegistry) SetPercentiles(ps []float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if ps == nil {
+		r.percentiles = nil
+		return
+	}
+	r.percentiles = make([]float64, len(ps))
+	copy(r.percentiles, ps)
+}
+
+// SetCardinalityLimit sets the number of metrics the registry holds at most,
+// not counting its OverflowName counter. Once it is reached, Register rejects
+// new names with a CardinalityLimitExceeded error and counts them in the
+// OverflowName counter. A limit of 0 is unlimited, the default.
+func (r *StandardRegistry) SetCardinalityLimit(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.limit = n
+}
+
+// Overflowed returns the number of registrations rejected because the
+// cardinality limit was reached.
+func (r *StandardRegistry) Overflowed() int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.overflow == nil {
+		return 0
+	}
+	return r.overflow.Count()
+}
+
+// DefaultPercentiles are the percentiles output for histograms and timers
+// when neither they nor their registry choose any.
+var DefaultPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// percentileName returns the name a percentile is output under, such as
+// "99.9%" for 0.999. The 50th percentile is output as "median".
+func percentileName(p float64) string {
+	if p == 0.5 {
+		return "median"
+	}
+	return strconv.FormatFloat(math.Round(p*100*1e9)/1e9, 'f', -1, 64) + "%"
+}
+
+// exportOptions holds the registry settings that control how metrics are
+// output. Nested registries inherit the options of their parent.
+type exportOptions struct {
+	timerUnit   time.Duration
+	percentiles []float64
+}
+
+// defaultExportOptions are the options used to output a top level registry.
+var defaultExportOptions = exportOptions{
+	timerUnit:   DefaultTimerUnit,
+	percentiles: DefaultPercentiles,
+}
+
+// exportOptionsProvider is implemented by registries whose settings override
+// the export options of their parent, such as a StandardRegistry and views
+// of it.
+type exportOptionsProvider interface {
+	exportOptions(parent exportOptions) exportOptions
+}
+
+// eachMetric calls f for every metric of a registry of any implementation,
+// with the export options of the registry. A nested registry inherits the
+// options of its parent unless it provides its own. The metrics and settings
+// of a StandardRegistry are read from a snapshot, so no lock is held while f
+// runs and Register never waits for an export.
+func eachMetric(r Registry, opts exportOptions, f func(name string, i interface{}, opts exportOptions)) {
+	if sr, ok := r.(*StandardRegistry); ok {
+		metrics, opts := sr.snapshot(opts)
+		for _, kv := range metrics {
+			f(kv.name, kv.value, opts)
+		}
+		return
+	}
+	if p, ok := r.(exportOptionsProvider); ok {
+		opts = p.exportOptions(opts)
+	}
+	r.Each(func(name string, i interface{}) { f(name, i, opts) })
+}
+
+// snapshot returns the registered metrics and the export options of the
+// registry, which override those of its parent, as of a single point in time.
+func (r *StandardRegistry) snapshot(opts exportOptions) ([]metricKV, exportOptions) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
+	return r.registeredLocked(), r.exportOptionsLocked(opts)
+}
+
+// exportOptions returns the export options of the registry, which override
+// those of its parent.
+func (r *StandardRegistry) exportOptions(parent exportOptions) exportOptions {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.exportOptionsLocked(parent)
+}
+
+func (r *StandardRegistry) exportOptionsLocked(opts exportOptions) exportOptions {
+	if r.timerUnit != 0 {
+		opts.timerUnit = r.timerUnit
+	}
+	if r.percentiles != nil {
+		opts.percentiles = r.percentiles
+	}
+	return opts
+}
+
+// RegistryJson returns the values of every metric of a registry of any
+// implementation in JSON format, as StandardRegistry.GetAllJson does. Other
+// implementations of Registry can use it to implement GetAllJson.
+func RegistryJson(r Registry) ([]byte, error) {
+	return json.Marshal(registryValue(r, defaultExportOptions))
+}
+
+// exportMarshalers are metrics whose output depends on the settings of the
+// registry they are output from, such as its timer unit. The metrics of this
+// package implement it alongside MetricMarshaler.
+type exportMarshaler interface {
+	marshalMetricWith(opts exportOptions) interface{}
+}
+
+// serializeMetric returns the value a metric is output as, and false if the
+// metric is not of a type the registry outputs.
+func serializeMetric(i interface{}, opts exportOptions) (interface{}, bool) {
+	switch metric := i.(type) {
+	case exportMarshaler:
+		return metric.marshalMetricWith(opts), true
+	case MetricMarshaler:
+		return marshalMetric(metric), true
+	}
+	return serializeInterface(i, opts)
+}
+
+// serializeInterface returns the value of a metric that implements one of
+// the metric interfaces of this package without implementing
+// MetricMarshaler, such as a Counter implemented outside of the package.
+func serializeInterface(i interface{}, opts exportOptions) (interface{}, bool) {
+	switch metric := i.(type) {
+	case Counter:
+		return metric.Count(), true
+	case Gauge:
+		return recoverValue(func() interface{} { return metric.Value() }), true
+	case GaugeFloat64:
+		return recoverValue(func() interface{} { return jsonFloat64(metric.Value()) }), true
+	case Meter:
+		return meterValue(metric.Snapshot()), true
+	case Timer:
+		return timerValue(metric, opts), true
+	case Histogram:
+		return histogramValue(metric, opts), true
+	case BucketedHistogram:
+		return bucketedHistogramValue(metric.Snapshot()), true
+	case Summary:
+		return summaryValue(metric), true
+	case MetricVec:
+		return vecValue(metric, opts), true
+	case Text:
+		return metric.Text(), true
+	case Slice:
+		return sliceValue(metric, opts), true
+	case Json:
+		return metric.Json(), true
+	case Registry:
+		return registryValue(metric, opts), true
+	}
+	return nil, false
+}
+
+// isMetric returns whether i is of a type the registry outputs.
+func isMetric(i interface{}) bool {
+	switch i.(type) {
+	case MetricMarshaler, Counter, Gauge, GaugeFloat64, Text, Meter, Timer, Histogram, BucketedHistogram, Summary, MetricVec, Registry, Slice, Json:
+		return true
+	}
+	return false
+}
 
+// registryValue returns the values of every metric of a registry, keyed by
+// name.
+func registryValue(r Registry, opts exportOptions) map[string]interface{} {
 	data := make(map[string]interface{})
-	r.Each(func(name string, i interface{}) {
-		values := make(map[string]interface{})
-		switch metric := i.(type) {
-		case Counter:
-			data[name] = metric.Count()
-		case Meter:
-			m := metric.Snapshot()
-			values["count"] = m.Count()
-			values["mean"] = m.RateMean()
-			values["lastValue"] = m.LastValue()
-			data[name] = values
-		case Timer:
-			t := metric
-			values["count"] = t.Count()
-			values["min"] = t.Min()
-			values["max"] = t.Max()
-			values["mean"] = t.Mean()
-			values["lastValue"] = t.LastValue()
-			values["executions"] = t.AllExecutions()
-			data[name] = values
-		case Histogram:
-			h := metric
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			values["count"] = h.Count()
-			values["min"] = h.Min()
-			values["max"] = h.Max()
-			values["mean"] = h.Mean()
-			values["stddev"] = h.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
-			data[name] = values
-		case Text:
-			data[name] = metric.Text()
-		case Slice:
-			slices := []interface{}{}
-			for _, r := range metric.GetAll() {
-				nestedReg := r.(*StandardRegistry)
-				slices = append(slices, nestedReg.serializeRegistry())
-			}
-			data[name] = slices
-		case Json:
-			data[name] = metric.Json()
-		case Registry:
-			nestedReg := metric.(*StandardRegistry)
-			data[name] = nestedReg.serializeRegistry()
+	eachMetric(r, opts, func(name string, i interface{}, opts exportOptions) {
+		if value, ok := serializeMetric(i, opts); ok {
+			data[name] = value
 		}
 	})
 	return data
 }
 
-// Output the value of all registered metrics in JSON format
+// MarshalMetric returns the values of the registry's metrics as output by
+// GetAllJson.
+func (r *StandardRegistry) MarshalMetric() (interface{}, error) {
+	return r.marshalMetricWith(defaultExportOptions), nil
+}
+
+func (r *StandardRegistry) marshalMetricWith(opts exportOptions) interface{} {
+	return registryValue(r, opts)
+}
+
+// recoverValue returns the result of f. A panic inside f, such as one raised
+// by the function of a FunctionalGauge, is reported as the value instead of
+// crashing the output of the whole registry.
+func recoverValue(f func() interface{}) (value interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			value = map[string]interface{}{"error": fmt.Sprintf("panic: %v", err)}
+		}
+	}()
+	return f()
+}
+
+// Output the value of all registered metrics in JSON format. The metrics are
+// read from a snapshot of the registry, so Register never waits for the
+// output.
 func (r *StandardRegistry) GetAllJson() ([]byte, error) {
-	data := r.serializeRegistry()
+	data := registryValue(r, defaultExportOptions)
 
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
@@ -137,41 +379,118 @@ func (r *StandardRegistry) GetAllJson() ([]byte, error) {
 }
 
 // Register the given metric under the given name.  Returns a DuplicateMetric
-// if a metric by the given name is already registered.
+// if a metric by the given name is already registered, and an error wrapping
+// ErrUnsupportedMetric if the metric is not of a type the registry outputs.
 func (r *StandardRegistry) Register(name string, i interface{}) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	return r.register(name, i)
 }
 
-// Unregister the metric with the given name.
+// Unregister the metric with the given name. If the registry created the
+// metric, in GetOrRegister or a NewRegistered constructor such as
+// NewRegisteredMeter, it is stopped to allow for garbage collection. A metric
+// passed to Register belongs to the caller, which may share it with other
+// registries, and must stop it, for example with Meter.Stop or Timer.StopMeter.
 func (r *StandardRegistry) Unregister(name string) {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	metric := r.metrics[name]
+	created := r.created[name]
 	delete(r.metrics, name)
+	delete(r.created, name)
+	if name == OverflowName {
+		r.overflow = nil
+	}
+	r.mutex.Unlock()
+	if created {
+		stopMetric(metric)
+	}
 }
 
-// Get the number of tracked metrics
+// Get the number of tracked metrics, not counting the registry's
+// OverflowName counter.
 func (r *StandardRegistry) MetricCount() int {
-	return len(r.registered())
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.metricCountLocked()
+}
+
+// metricCountLocked returns the number of registered metrics besides the
+// overflow counter. The caller must hold the registry's lock.
+func (r *StandardRegistry) metricCountLocked() int {
+	if r.overflow != nil {
+		return len(r.metrics) - 1
+	}
+	return len(r.metrics)
 }
 
 // Create a new registry.
 func NewRegistry() Registry {
-	return &StandardRegistry{metrics: make(map[string]interface{})}
+	return &StandardRegistry{
+		metrics: make(map[string]interface{}),
+		created: make(map[string]bool),
+	}
+}
+
+// registerCreated registers a metric made for the registry by a NewRegistered
+// constructor, which the registry stops when it is unregistered, as it does
+// the metrics it makes in GetOrRegister. Other registries register it as
+// Register does.
+func registerCreated(r Registry, name string, i interface{}) error {
+	sr, ok := r.(*StandardRegistry)
+	if !ok {
+		return r.Register(name, i)
+	}
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	if err := sr.register(name, i); err != nil {
+		return err
+	}
+	sr.created[name] = true
+	return nil
 }
 
 func (r *StandardRegistry) register(name string, i interface{}) error {
+	if name == OverflowName {
+		return ReservedMetricName(name)
+	}
 	if _, ok := r.metrics[name]; ok {
 		return DuplicateMetric(name)
 	}
-	switch i.(type) {
-	case Counter, Text, Meter, Timer, Histogram, Registry, Slice, Json:
-		r.metrics[name] = i
+	if !isMetric(i) {
+		return unsupportedMetric(name, i)
 	}
+	if r.limitReached() {
+		if r.overflow == nil {
+			r.overflow = NewCounter()
+			r.metrics[OverflowName] = r.overflow
+		}
+		r.overflow.Inc(1)
+		return CardinalityLimitExceeded(name)
+	}
+	r.metrics[name] = i
 	return nil
 }
 
+// limitReached returns whether the registry holds as many metrics as its
+// cardinality limit allows.
+func (r *StandardRegistry) limitReached() bool {
+	return r.limit > 0 && r.metricCountLocked() >= r.limit
+}
+
+// stopMetric stops the background ticking of a metric that is being
+// unregistered to allow for garbage collection.
+func stopMetric(i interface{}) {
+	switch metric := i.(type) {
+	case Meter:
+		metric.Stop()
+	case Timer:
+		metric.StopMeter()
+	case MetricVec:
+		metric.EachChild(func(_ []string, child interface{}) { stopMetric(child) })
+	}
+}
+
 type metricKV struct {
 	name  string
 	value interface{}
@@ -180,6 +499,12 @@ type metricKV struct {
 func (r *StandardRegistry) registered() []metricKV {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
+	return r.registeredLocked()
+}
+
+// registeredLocked returns a copy of the registered metrics. The caller must
+// hold the registry's lock.
+func (r *StandardRegistry) registeredLocked() []metricKV {
 	metrics := make([]metricKV, 0, len(r.metrics))
 	for name, i := range r.metrics {
 		metrics = append(metrics, metricKV{
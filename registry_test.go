@@ -1,9 +1,12 @@
 package metrics
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func BenchmarkRegistry(b *testing.B) {
@@ -161,6 +164,45 @@ func TestRegistryUnregister(t *testing.T) {
 
 }
 
+func TestRegistryCardinalityLimit(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetCardinalityLimit(2)
+	for i := 0; i < 5; i++ {
+		err := r.Register(fmt.Sprintf("user%d", i), NewCounter())
+		if _, ok := err.(CardinalityLimitExceeded); (i >= 2) != ok {
+			t.Errorf("r.Register(user%d): %v\n", i, err)
+		}
+	}
+	if _, ok := r.Register("user0", NewCounter()).(DuplicateMetric); !ok {
+		t.Errorf("r.Register(user0) is not a duplicate\n")
+	}
+	if overflowed := r.(*StandardRegistry).Overflowed(); 3 != overflowed {
+		t.Errorf("r.Overflowed(): 3 != %v\n", overflowed)
+	}
+	values := registryValues(t, r)
+	if overflow := values[OverflowName]; 3.0 != overflow {
+		t.Errorf("%s: 3 != %v\n", OverflowName, overflow)
+	}
+	if 3 != len(values) {
+		t.Errorf("len(values): 3 != %v\n", len(values))
+	}
+	if count := r.MetricCount(); 2 != count {
+		t.Errorf("r.MetricCount(): 2 != %v\n", count)
+	}
+	if _, ok := r.Register(OverflowName, NewCounter()).(ReservedMetricName); !ok {
+		t.Errorf("r.Register(%s) is not reserved\n", OverflowName)
+	}
+	if _, ok := NewRegistry().Register(OverflowName, NewCounter()).(ReservedMetricName); !ok {
+		t.Errorf("r.Register(%s) without a limit is not reserved\n", OverflowName)
+	}
+
+	// Room freed by unregistering a metric can be used again.
+	r.Unregister("user1")
+	if err := r.Register("user5", NewCounter()); err != nil {
+		t.Errorf("r.Register(user5): %v\n", err)
+	}
+}
+
 func TestConcurrentRegistryAccess(t *testing.T) {
 	r := NewRegistry()
 
@@ -217,3 +259,177 @@ func TestRegisterAndRegisteredConcurrency(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// blockingMetric calls its function when it is output.
+type blockingMetric func()
+
+func (m blockingMetric) MarshalMetric() (interface{}, error) {
+	m()
+	return nil, nil
+}
+
+func TestRegistryExportDoesNotBlockRegister(t *testing.T) {
+	r := NewRegistry()
+	nested := NewRegistry()
+	r.Register("nested", nested)
+	// Register into both registries while the nested registry is being
+	// output, which deadlocked while export held their read locks.
+	nested.Register("block", blockingMetric(func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.Register("foo", NewCounter())
+			nested.Register("bar", NewCounter())
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("Register blocked by GetAllJson")
+		}
+	}))
+	if _, err := r.GetAllJson(); err != nil {
+		t.Fatal(err)
+	}
+	if count := nested.MetricCount(); 2 != count {
+		t.Errorf("nested.MetricCount(): 2 != %v\n", count)
+	}
+}
+
+func TestRegistryConcurrentRegisterAndExport(t *testing.T) {
+	r := NewRegistry()
+	nested := NewRegistry()
+	r.Register("nested", nested)
+	slice := NewRegisteredSlice("slice", r)
+	slice.Append(nested)
+	text := NewRegisteredText("text", r)
+	js := NewRegisteredJson("json", r)
+	vec := NewRegisteredTimerVec("vec", nested, []string{"worker"})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				name := fmt.Sprintf("metric%d.%d", i, j%50)
+				c, _ := GetOrRegister(r, name, NewCounter)
+				c.Inc(1)
+				timer, _ := GetOrRegister(nested, name, NewTimer)
+				timer.Update(time.Duration(j))
+				vec.WithLabelValues(fmt.Sprint(j % 10)).Update(time.Duration(j))
+				text.Set(name)
+				js.Set(json.RawMessage(fmt.Sprintf("%q", name)))
+				if j%7 == 0 {
+					r.Unregister(name)
+					nested.Unregister(name)
+				}
+				if j%50 == 0 {
+					slice.Clear()
+					slice.Append(nested)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := r.GetAllJson(); err != nil {
+					t.Error(err)
+				}
+				r.(*StandardRegistry).SetTimerUnit(time.Millisecond)
+			}
+		}()
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+// registryValues outputs the registry and decodes the output.
+func registryValues(t *testing.T, r Registry) map[string]interface{} {
+	js, err := r.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(js, &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+// registryWith returns a new registry holding the given metric.
+func registryWith(name string, i interface{}) Registry {
+	r := NewRegistry()
+	r.Register(name, i)
+	return r
+}
+
+// prefixedRegistry is a Registry implemented outside of the package that
+// prefixes the names of the metrics of the registry it wraps.
+type prefixedRegistry struct {
+	prefix string
+	r      Registry
+}
+
+func (p *prefixedRegistry) Each(f func(string, interface{})) {
+	p.r.Each(func(name string, i interface{}) { f(p.prefix+name, i) })
+}
+func (p *prefixedRegistry) Get(name string) interface{} {
+	return p.r.Get(strings.TrimPrefix(name, p.prefix))
+}
+func (p *prefixedRegistry) GetAllJson() ([]byte, error) { return RegistryJson(p) }
+func (p *prefixedRegistry) Register(name string, i interface{}) error {
+	return p.r.Register(strings.TrimPrefix(name, p.prefix), i)
+}
+func (p *prefixedRegistry) Unregister(name string) {
+	p.r.Unregister(strings.TrimPrefix(name, p.prefix))
+}
+func (p *prefixedRegistry) MetricCount() int { return p.r.MetricCount() }
+
+func TestRegistryNestedImplementation(t *testing.T) {
+	c := NewCounter()
+	c.Inc(47)
+	timer := NewTimer()
+	timer.Update(2 * time.Millisecond)
+	inner := NewRegistry()
+	inner.Register("count", c)
+	inner.Register("latency", timer)
+	p := &prefixedRegistry{prefix: "db.", r: inner}
+
+	r := NewRegistry()
+	r.(*StandardRegistry).SetTimerUnit(time.Millisecond)
+	r.Register("nested", p)
+	s := NewRegisteredSlice("slice", r)
+	s.Append(p)
+
+	values := registryValues(t, r)
+	for _, nested := range []interface{}{values["nested"], values["slice"].([]interface{})[0]} {
+		nested := nested.(map[string]interface{})
+		if count := nested["db.count"]; 47.0 != count {
+			t.Errorf("db.count: 47 != %v\n", count)
+		}
+		// The wrapper inherits the settings of the registry it is nested in.
+		if max := nested["db.latency"].(map[string]interface{})["max"]; 2.0 != max {
+			t.Errorf("db.latency max: 2 != %v\n", max)
+		}
+	}
+
+	js, err := p.GetAllJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"db.count":47`) {
+		t.Errorf("p.GetAllJson(): %s\n", js)
+	}
+}
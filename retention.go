@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultTimerHistory is the number of past executions a Timer keeps when no
+// RetentionPolicy is given.
+const DefaultTimerHistory = 100
+
+// TimerExecution is a single execution recorded by a Timer.
+type TimerExecution struct {
+	Time     time.Time     // When the execution was recorded
+	Duration time.Duration // How long the execution took
+}
+
+// RetentionPolicies decide which past executions a Timer keeps so its
+// history does not grow without bound.
+type RetentionPolicy interface {
+	// Retain returns the part of the history to keep at the given time. The
+	// history is ordered from oldest to newest execution.
+	Retain(history []TimerExecution, now time.Time) []TimerExecution
+}
+
+// RetainLast returns a RetentionPolicy that keeps the n most recent
+// executions.
+func RetainLast(n int) RetentionPolicy {
+	if n < 0 {
+		n = 0
+	}
+	return retainLast(n)
+}
+
+// RetainNone returns a RetentionPolicy that keeps no executions.
+func RetainNone() RetentionPolicy {
+	return retainLast(0)
+}
+
+// RetainWindow returns a RetentionPolicy that keeps the executions recorded
+// within the given duration.
+func RetainWindow(d time.Duration) RetentionPolicy {
+	return retainWindow(d)
+}
+
+type retainLast int
+
+func (n retainLast) Retain(history []TimerExecution, _ time.Time) []TimerExecution {
+	if len(history) > int(n) {
+		return history[len(history)-int(n):]
+	}
+	return history
+}
+
+type retainWindow time.Duration
+
+func (w retainWindow) Retain(history []TimerExecution, now time.Time) []TimerExecution {
+	cutoff := now.Add(-time.Duration(w))
+	i := sort.Search(len(history), func(i int) bool {
+		return history[i].Time.After(cutoff)
+	})
+	return history[i:]
+}
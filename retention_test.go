@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func testHistory(now time.Time, n int) []TimerExecution {
+	history := make([]TimerExecution, n)
+	for i := range history {
+		history[i] = TimerExecution{
+			Time:     now.Add(time.Duration(i-n+1) * time.Second),
+			Duration: time.Duration(i),
+		}
+	}
+	return history
+}
+
+func TestRetainLast(t *testing.T) {
+	now := time.Now()
+	kept := RetainLast(3).Retain(testHistory(now, 10), now)
+	if 3 != len(kept) {
+		t.Fatalf("len(kept): 3 != %d\n", len(kept))
+	}
+	if d := kept[0].Duration; 7 != d {
+		t.Errorf("kept[0].Duration: 7 != %d\n", d)
+	}
+	if kept := RetainLast(30).Retain(testHistory(now, 10), now); 10 != len(kept) {
+		t.Errorf("len(kept): 10 != %d\n", len(kept))
+	}
+}
+
+func TestRetainNone(t *testing.T) {
+	now := time.Now()
+	if kept := RetainNone().Retain(testHistory(now, 10), now); 0 != len(kept) {
+		t.Errorf("len(kept): 0 != %d\n", len(kept))
+	}
+}
+
+func TestRetainWindow(t *testing.T) {
+	now := time.Now()
+	kept := RetainWindow(5*time.Second).Retain(testHistory(now, 10), now)
+	if 5 != len(kept) {
+		t.Fatalf("len(kept): 5 != %d\n", len(kept))
+	}
+	if d := kept[0].Duration; 5 != d {
+		t.Errorf("kept[0].Duration: 5 != %d\n", d)
+	}
+	if kept := RetainWindow(5*time.Second).Retain(testHistory(now, 10), now.Add(time.Minute)); 0 != len(kept) {
+		t.Errorf("len(kept): 0 != %d\n", len(kept))
+	}
+}
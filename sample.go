@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"sort"
@@ -10,6 +13,14 @@ import (
 
 const rescaleThreshold = time.Hour
 
+// ErrIncompatibleSample is returned when merging samples of different kinds
+// or configurations.
+var ErrIncompatibleSample = errors.New("metrics: incompatible samples")
+
+// ErrInvalidSampleEncoding is returned when decoding data that was not
+// produced by the MarshalBinary method of a MergeableSample.
+var ErrInvalidSampleEncoding = errors.New("metrics: invalid sample encoding")
+
 // Samples maintain a statistically-significant selection of values from
 // a stream.
 type Sample interface {
@@ -28,6 +39,43 @@ type Sample interface {
 	Variance() float64
 }
 
+// MergeableSamples can be combined with another sample of the same kind, such
+// as the same histogram recorded by another registry or process. They are
+// encoded with MarshalBinary so they can be sent to where they are combined.
+type MergeableSample interface {
+	Sample
+	Merge(Sample) error
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary([]byte) error
+}
+
+// The first byte of an encoded MergeableSample identifies its kind.
+const (
+	sampleKindTDigest byte = iota + 1
+	sampleKindDDSketch
+)
+
+// DecodeSample decodes a MergeableSample of any kind from the output of its
+// MarshalBinary method.
+func DecodeSample(b []byte) (MergeableSample, error) {
+	if 0 == len(b) {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidSampleEncoding)
+	}
+	var s MergeableSample
+	switch b[0] {
+	case sampleKindTDigest:
+		s = &TDigestSample{}
+	case sampleKindDDSketch:
+		s = &DDSketchSample{}
+	default:
+		return nil, fmt.Errorf("%w: unknown sample kind %d", ErrInvalidSampleEncoding, b[0])
+	}
+	if err := s.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 // ExpDecaySample is an exponentially-decaying sample using a forward-decaying
 // priority reservoir.  See Cormode et al's "Forward Decay: A Practical Time
 // Decay Model for Streaming Systems".
@@ -166,6 +214,353 @@ func (s *ExpDecaySample) update(t time.Time, v int64) {
 	}
 }
 
+// UniformSample is a uniform sample using Vitter's Algorithm R.
+//
+// <http://www.cs.umd.edu/~samir/498/vitter.pdf>
+type UniformSample struct {
+	count         int64
+	mutex         sync.Mutex
+	reservoirSize int
+	values        []int64
+}
+
+// NewUniformSample constructs a new uniform sample with the given reservoir
+// size.
+func NewUniformSample(reservoirSize int) Sample {
+	return &UniformSample{
+		reservoirSize: reservoirSize,
+		values:        make([]int64, 0, reservoirSize),
+	}
+}
+
+// Clear clears all samples.
+func (s *UniformSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+	s.values = make([]int64, 0, s.reservoirSize)
+}
+
+// Count returns the number of samples recorded, which may exceed the
+// reservoir size.
+func (s *UniformSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value in the sample, which may not be the maximum
+// value ever to be part of the sample.
+func (s *UniformSample) Max() int64 {
+	return SampleMax(s.Values())
+}
+
+// Mean returns the mean of the values in the sample.
+func (s *UniformSample) Mean() float64 {
+	return SampleMean(s.Values())
+}
+
+// Min returns the minimum value in the sample, which may not be the minimum
+// value ever to be part of the sample.
+func (s *UniformSample) Min() int64 {
+	return SampleMin(s.Values())
+}
+
+// Percentile returns an arbitrary percentile of values in the sample.
+func (s *UniformSample) Percentile(p float64) float64 {
+	return SamplePercentile(s.Values(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// sample.
+func (s *UniformSample) Percentiles(ps []float64) []float64 {
+	return SamplePercentiles(s.Values(), ps)
+}
+
+// Size returns the size of the sample, which is at most the reservoir size.
+func (s *UniformSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.values)
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (s *UniformSample) StdDev() float64 {
+	return SampleStdDev(s.Values())
+}
+
+// Sum returns the sum of the values in the sample.
+func (s *UniformSample) Sum() int64 {
+	return SampleSum(s.Values())
+}
+
+// Update samples a new value.
+func (s *UniformSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	if len(s.values) < s.reservoirSize {
+		s.values = append(s.values, v)
+	} else if r := rand.Int63n(s.count); r < int64(len(s.values)) {
+		s.values[int(r)] = v
+	}
+}
+
+// Values returns a copy of the values in the sample.
+func (s *UniformSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make([]int64, len(s.values))
+	copy(values, s.values)
+	return values
+}
+
+// Variance returns the variance of the values in the sample.
+func (s *UniformSample) Variance() float64 {
+	return SampleVariance(s.Values())
+}
+
+// SlidingWindowSample is a sample of the most recently recorded values,
+// stored in a ring buffer.
+type SlidingWindowSample struct {
+	count  int64
+	mutex  sync.Mutex
+	next   int
+	values []int64
+}
+
+// NewSlidingWindowSample constructs a new sample of the last size values.
+func NewSlidingWindowSample(size int) Sample {
+	return &SlidingWindowSample{values: make([]int64, 0, size)}
+}
+
+// Clear clears all samples.
+func (s *SlidingWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+	s.next = 0
+	s.values = s.values[:0]
+}
+
+// Count returns the number of samples recorded, which may exceed the
+// window size.
+func (s *SlidingWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value in the window, which may not be the maximum
+// value ever to be part of the sample.
+func (s *SlidingWindowSample) Max() int64 {
+	return SampleMax(s.Values())
+}
+
+// Mean returns the mean of the values in the window.
+func (s *SlidingWindowSample) Mean() float64 {
+	return SampleMean(s.Values())
+}
+
+// Min returns the minimum value in the window, which may not be the minimum
+// value ever to be part of the sample.
+func (s *SlidingWindowSample) Min() int64 {
+	return SampleMin(s.Values())
+}
+
+// Percentile returns an arbitrary percentile of values in the window.
+func (s *SlidingWindowSample) Percentile(p float64) float64 {
+	return SamplePercentile(s.Values(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// window.
+func (s *SlidingWindowSample) Percentiles(ps []float64) []float64 {
+	return SamplePercentiles(s.Values(), ps)
+}
+
+// Size returns the number of values in the window, which is at most the
+// window size.
+func (s *SlidingWindowSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.values)
+}
+
+// StdDev returns the standard deviation of the values in the window.
+func (s *SlidingWindowSample) StdDev() float64 {
+	return SampleStdDev(s.Values())
+}
+
+// Sum returns the sum of the values in the window.
+func (s *SlidingWindowSample) Sum() int64 {
+	return SampleSum(s.Values())
+}
+
+// Update samples a new value, replacing the oldest value once the window is
+// full.
+func (s *SlidingWindowSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	if len(s.values) < cap(s.values) {
+		s.values = append(s.values, v)
+		return
+	}
+	if 0 == len(s.values) {
+		return
+	}
+	s.values[s.next] = v
+	s.next = (s.next + 1) % len(s.values)
+}
+
+// Values returns a copy of the values in the window, from oldest to newest.
+func (s *SlidingWindowSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make([]int64, 0, len(s.values))
+	values = append(values, s.values[s.next:]...)
+	return append(values, s.values[:s.next]...)
+}
+
+// Variance returns the variance of the values in the window.
+func (s *SlidingWindowSample) Variance() float64 {
+	return SampleVariance(s.Values())
+}
+
+// SlidingTimeWindowSample is a sample of every value recorded within a
+// trailing window of time.
+type SlidingTimeWindowSample struct {
+	count  int64
+	mutex  sync.Mutex
+	window time.Duration
+	values []timedValue
+}
+
+// timedValue is a value recorded by a SlidingTimeWindowSample.
+type timedValue struct {
+	t time.Time
+	v int64
+}
+
+// NewSlidingTimeWindowSample constructs a new sample of the values recorded
+// within the last window of time.
+func NewSlidingTimeWindowSample(window time.Duration) Sample {
+	return &SlidingTimeWindowSample{window: window}
+}
+
+// Clear clears all samples.
+func (s *SlidingTimeWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+	s.values = nil
+}
+
+// Count returns the number of samples recorded, which may exceed the number
+// of values in the window.
+func (s *SlidingTimeWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value in the window, which may not be the maximum
+// value ever to be part of the sample.
+func (s *SlidingTimeWindowSample) Max() int64 {
+	return SampleMax(s.Values())
+}
+
+// Mean returns the mean of the values in the window.
+func (s *SlidingTimeWindowSample) Mean() float64 {
+	return SampleMean(s.Values())
+}
+
+// Min returns the minimum value in the window, which may not be the minimum
+// value ever to be part of the sample.
+func (s *SlidingTimeWindowSample) Min() int64 {
+	return SampleMin(s.Values())
+}
+
+// Percentile returns an arbitrary percentile of values in the window.
+func (s *SlidingTimeWindowSample) Percentile(p float64) float64 {
+	return SamplePercentile(s.Values(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// window.
+func (s *SlidingTimeWindowSample) Percentiles(ps []float64) []float64 {
+	return SamplePercentiles(s.Values(), ps)
+}
+
+// Size returns the number of values in the window.
+func (s *SlidingTimeWindowSample) Size() int {
+	return len(s.Values())
+}
+
+// StdDev returns the standard deviation of the values in the window.
+func (s *SlidingTimeWindowSample) StdDev() float64 {
+	return SampleStdDev(s.Values())
+}
+
+// Sum returns the sum of the values in the window.
+func (s *SlidingTimeWindowSample) Sum() int64 {
+	return SampleSum(s.Values())
+}
+
+// Update samples a new value.
+func (s *SlidingTimeWindowSample) Update(v int64) {
+	s.update(time.Now(), v)
+}
+
+// Values returns a copy of the values in the window, from oldest to newest.
+func (s *SlidingTimeWindowSample) Values() []int64 {
+	return s.valuesAt(time.Now())
+}
+
+// Variance returns the variance of the values in the window.
+func (s *SlidingTimeWindowSample) Variance() float64 {
+	return SampleVariance(s.Values())
+}
+
+// update samples a new value at a particular timestamp.  This is a method all
+// its own to facilitate testing.
+func (s *SlidingTimeWindowSample) update(t time.Time, v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	s.values = append(s.values, timedValue{t: t, v: v})
+	s.trim(t)
+}
+
+// valuesAt returns a copy of the values in the window ending at a particular
+// timestamp.  This is a method all its own to facilitate testing.
+func (s *SlidingTimeWindowSample) valuesAt(t time.Time) []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trim(t)
+	values := make([]int64, len(s.values))
+	for i, v := range s.values {
+		values[i] = v.v
+	}
+	return values
+}
+
+// trim drops the values that fall out of the window ending at t.
+func (s *SlidingTimeWindowSample) trim(t time.Time) {
+	cutoff := t.Add(-s.window)
+	i := sort.Search(len(s.values), func(i int) bool {
+		return s.values[i].t.After(cutoff)
+	})
+	if i == 0 {
+		return
+	}
+	// Copy the remaining values to the front so the dropped ones can be
+	// garbage collected instead of pinning the old backing array.
+	n := copy(s.values, s.values[i:])
+	s.values = s.values[:n]
+}
+
 // SampleMax returns the maximum value of the slice of int64.
 func SampleMax(values []int64) int64 {
 	if 0 == len(values) {
@@ -338,3 +733,174 @@ type int64Slice []int64
 func (p int64Slice) Len() int           { return len(p) }
 func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
 func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// sampleStats tracks the exact count, extremes, sum, mean and variance of
+// the values recorded by samples that do not keep the values themselves.
+type sampleStats struct {
+	count    int64
+	min, max int64
+	sum      int64
+	mean, m2 float64
+}
+
+func newSampleStats() sampleStats {
+	return sampleStats{min: math.MaxInt64, max: math.MinInt64}
+}
+
+// update records a value, using Welford's online algorithm for the variance.
+func (s *sampleStats) update(v int64) {
+	s.count++
+	s.sum += v
+	if v < s.min {
+		s.min = v
+	}
+	if v > s.max {
+		s.max = v
+	}
+	d := float64(v) - s.mean
+	s.mean += d / float64(s.count)
+	s.m2 += d * (float64(v) - s.mean)
+}
+
+// merge folds the statistics of other values in, using Chan et al's
+// parallel algorithm for the variance.
+func (s *sampleStats) merge(o sampleStats) {
+	if 0 == o.count {
+		return
+	}
+	total := s.count + o.count
+	delta := o.mean - s.mean
+	s.mean += delta * float64(o.count) / float64(total)
+	s.m2 += o.m2 + delta*delta*float64(s.count)*float64(o.count)/float64(total)
+	s.count = total
+	s.sum += o.sum
+	if o.min < s.min {
+		s.min = o.min
+	}
+	if o.max > s.max {
+		s.max = o.max
+	}
+}
+
+// Min returns the minimum value recorded, or 0 if none were.
+func (s *sampleStats) Min() int64 {
+	if 0 == s.count {
+		return 0
+	}
+	return s.min
+}
+
+// Max returns the maximum value recorded, or 0 if none were.
+func (s *sampleStats) Max() int64 {
+	if 0 == s.count {
+		return 0
+	}
+	return s.max
+}
+
+// Variance returns the variance of the values recorded.
+func (s *sampleStats) Variance() float64 {
+	if 0 == s.count {
+		return 0.0
+	}
+	return s.m2 / float64(s.count)
+}
+
+func (s *sampleStats) appendBinary(b []byte) []byte {
+	b = binary.AppendVarint(b, s.count)
+	b = binary.AppendVarint(b, s.min)
+	b = binary.AppendVarint(b, s.max)
+	b = binary.AppendVarint(b, s.sum)
+	b = appendFloat64(b, s.mean)
+	return appendFloat64(b, s.m2)
+}
+
+func (d *sampleDecoder) stats() sampleStats {
+	return sampleStats{
+		count: d.varint(),
+		min:   d.varint(),
+		max:   d.varint(),
+		sum:   d.varint(),
+		mean:  d.float64(),
+		m2:    d.float64(),
+	}
+}
+
+// appendFloat64 appends the bits of a float64 to an encoded sample.
+func appendFloat64(b []byte, f float64) []byte {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+}
+
+// sampleDecoder reads the fields of an encoded sample, remembering the first
+// error so they can be read without checking each one.
+type sampleDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *sampleDecoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: truncated", ErrInvalidSampleEncoding)
+	}
+	d.b = nil
+}
+
+func (d *sampleDecoder) byte() byte {
+	if len(d.b) < 1 {
+		d.fail()
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *sampleDecoder) float64() float64 {
+	if len(d.b) < 8 {
+		d.fail()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.b))
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *sampleDecoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *sampleDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// length reads the number of following entries, each at least size bytes
+// long, failing if the remaining data cannot hold them.
+func (d *sampleDecoder) length(size int) int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)/size) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+// finish returns the first error encountered, or an error if data is left
+// over.
+func (d *sampleDecoder) finish() error {
+	if d.err == nil && len(d.b) > 0 {
+		d.err = fmt.Errorf("%w: %d trailing bytes", ErrInvalidSampleEncoding, len(d.b))
+	}
+	return d.err
+}
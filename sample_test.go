@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"fmt"
 	"runtime"
 	"testing"
 	"time"
@@ -66,15 +67,23 @@ func BenchmarkExpDecaySample1028(b *testing.B) {
 }
 
 func BenchmarkUniformSample257(b *testing.B) {
-	benchmarkSample(b, NewExpDecaySample(257, 0))
+	benchmarkSample(b, NewUniformSample(257))
 }
 
 func BenchmarkUniformSample514(b *testing.B) {
-	benchmarkSample(b, NewExpDecaySample(514, 0))
+	benchmarkSample(b, NewUniformSample(514))
 }
 
 func BenchmarkUniformSample1028(b *testing.B) {
-	benchmarkSample(b, NewExpDecaySample(1028, 0))
+	benchmarkSample(b, NewUniformSample(1028))
+}
+
+func BenchmarkSlidingWindowSample1028(b *testing.B) {
+	benchmarkSample(b, NewSlidingWindowSample(1028))
+}
+
+func BenchmarkSlidingTimeWindowSample(b *testing.B) {
+	benchmarkSample(b, NewSlidingTimeWindowSample(time.Second))
 }
 
 func TestExpDecaySample10(t *testing.T) {
@@ -175,6 +184,120 @@ func TestExpDecaySampleRescale(t *testing.T) {
 	}
 }
 
+// reservoirSamples construct every reservoir Sample implementation with room
+// for 100 values.
+var reservoirSamples = map[string]func() Sample{
+	"ExpDecaySample":      func() Sample { return NewExpDecaySample(100, 0.99) },
+	"UniformSample":       func() Sample { return NewUniformSample(100) },
+	"SlidingWindowSample": func() Sample { return NewSlidingWindowSample(100) },
+}
+
+func TestSamples(t *testing.T) {
+	for name, newSample := range reservoirSamples {
+		for _, n := range []int{10, 100, 1000} {
+			t.Run(fmt.Sprintf("%s/%d", name, n), func(t *testing.T) {
+				testSample(t, newSample(), n, min(n, 100))
+			})
+		}
+	}
+	for _, n := range []int{10, 100, 1000} {
+		t.Run(fmt.Sprintf("SlidingTimeWindowSample/%d", n), func(t *testing.T) {
+			testSample(t, NewSlidingTimeWindowSample(time.Minute), n, n)
+		})
+	}
+}
+
+// testSample updates the sample with the values [0, n) and checks that it
+// holds size of them.
+func testSample(t *testing.T, s Sample, n int, size int) {
+	for i := 0; i < n; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); int64(n) != count {
+		t.Errorf("s.Count(): %v != %v\n", n, count)
+	}
+	if sz := s.Size(); size != sz {
+		t.Errorf("s.Size(): %v != %v\n", size, sz)
+	}
+	values := s.Values()
+	if l := len(values); size != l {
+		t.Errorf("len(s.Values()): %v != %v\n", size, l)
+	}
+	for _, v := range values {
+		if v >= int64(n) || v < 0 {
+			t.Errorf("out of range [0, %d): %v\n", n, v)
+		}
+	}
+	if min := s.Min(); SampleMin(values) != min {
+		t.Errorf("s.Min(): %v != %v\n", SampleMin(values), min)
+	}
+	if max := s.Max(); SampleMax(values) != max {
+		t.Errorf("s.Max(): %v != %v\n", SampleMax(values), max)
+	}
+	if mean := s.Mean(); SampleMean(values) != mean {
+		t.Errorf("s.Mean(): %v != %v\n", SampleMean(values), mean)
+	}
+	if sum := s.Sum(); SampleSum(values) != sum {
+		t.Errorf("s.Sum(): %v != %v\n", SampleSum(values), sum)
+	}
+	if stdDev := s.StdDev(); SampleStdDev(values) != stdDev {
+		t.Errorf("s.StdDev(): %v != %v\n", SampleStdDev(values), stdDev)
+	}
+	ps := s.Percentiles([]float64{0.5, 0.99})
+	if ps[0] > ps[1] || ps[0] < float64(s.Min()) || ps[1] > float64(s.Max()) {
+		t.Errorf("s.Percentiles(): %v out of order\n", ps)
+	}
+	s.Clear()
+	if count, sz := s.Count(), s.Size(); 0 != count || 0 != sz {
+		t.Errorf("s.Count(), s.Size() after clear: %v, %v\n", count, sz)
+	}
+}
+
+func TestUniformSampleIncludesTail(t *testing.T) {
+	s := NewUniformSample(100)
+	max := 100
+	for i := 0; i < max; i++ {
+		s.Update(int64(i))
+	}
+	v := s.Values()
+	sum := 0
+	exp := (max - 1) * max / 2
+	for i := 0; i < len(v); i++ {
+		sum += int(v[i])
+	}
+	if exp != sum {
+		t.Errorf("sum: %v != %v\n", exp, sum)
+	}
+}
+
+func TestSlidingWindowSampleKeepsLast(t *testing.T) {
+	s := NewSlidingWindowSample(3)
+	for i := 0; i < 10; i++ {
+		s.Update(int64(i))
+	}
+	v := s.Values()
+	if 3 != len(v) || 7 != v[0] || 8 != v[1] || 9 != v[2] {
+		t.Errorf("s.Values(): [7 8 9] != %v\n", v)
+	}
+}
+
+func TestSlidingTimeWindowSampleExpires(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute).(*SlidingTimeWindowSample)
+	now := time.Now()
+	s.update(now.Add(-2*time.Minute), 1)
+	s.update(now.Add(-30*time.Second), 2)
+	s.update(now, 3)
+	if v := s.valuesAt(now); 2 != len(v) || 2 != v[0] || 3 != v[1] {
+		t.Errorf("s.valuesAt(now): [2 3] != %v\n", v)
+	}
+	if v := s.valuesAt(now.Add(time.Minute)); 0 != len(v) {
+		t.Errorf("s.valuesAt(now+1m): [] != %v\n", v)
+	}
+	if count := s.Count(); 3 != count {
+		t.Errorf("s.Count(): 3 != %v\n", count)
+	}
+}
+
 func benchmarkSample(b *testing.B, s Sample) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
@@ -1,6 +1,9 @@
 package metrics
 
-import "os"
+import (
+	"os"
+	"sync"
+)
 
 // Counters hold an int64 value that can be incremented and decremented.
 type Slice interface {
@@ -20,7 +23,7 @@ func NewRegisteredSlice(name string, r Registry) Slice {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, s)
+	err := registerCreated(r, name, s)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -35,22 +38,52 @@ func GetSlice(name string, r Registry) Slice {
 	return r.Get(name).(Slice)
 }
 
-// StandardSlice is the standard implementation of a Slice metrics set
+// StandardSlice is the standard implementation of a Slice metrics set and is
+// safe for concurrent use.
 type StandardSlice struct {
-	data []Registry
+	mutex sync.RWMutex
+	data  []Registry
 }
 
 // Append a registry onto the slice
 func (s *StandardSlice) Append(r Registry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.data = append(s.data, r)
 }
 
-// Return all included registries
+// Return a copy of all included registries
 func (s *StandardSlice) GetAll() []Registry {
-	return s.data
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data := make([]Registry, len(s.data))
+	copy(data, s.data)
+	return data
 }
 
 // Clear sets the slize to empty
 func (s *StandardSlice) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.data = []Registry{}
 }
+
+// MarshalMetric returns the values of the included registries as output by
+// a registry with the default settings.
+func (s *StandardSlice) MarshalMetric() (interface{}, error) {
+	return s.marshalMetricWith(defaultExportOptions), nil
+}
+
+func (s *StandardSlice) marshalMetricWith(opts exportOptions) interface{} {
+	return sliceValue(s, opts)
+}
+
+// sliceValue returns the values a Slice is output as, each registry with the
+// settings of the registry the slice belongs to.
+func sliceValue(s Slice, opts exportOptions) []interface{} {
+	values := []interface{}{}
+	for _, r := range s.GetAll() {
+		values = append(values, registryValue(r, opts))
+	}
+	return values
+}
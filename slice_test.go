@@ -1,6 +1,9 @@
 package metrics
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func createTestReg() Registry {
 	r := NewRegistry()
@@ -40,3 +43,35 @@ func TestSliceZero(t *testing.T) {
 		t.Errorf("Did not generate empty slice")
 	}
 }
+
+func TestSliceGetAllCopies(t *testing.T) {
+	s := NewSlice()
+	s.Append(createTestReg())
+	all := s.GetAll()
+	s.Append(createTestReg())
+	s.Clear()
+	if len(all) != 1 || all[0] == nil {
+		t.Errorf("s.GetAll() changed by later Append and Clear: %v", all)
+	}
+}
+
+func TestSliceConcurrent(t *testing.T) {
+	s := NewSlice()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Append(createTestReg())
+				for _, r := range s.GetAll() {
+					r.Get("bar")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if l := len(s.GetAll()); 1000 != l {
+		t.Errorf("len(s.GetAll()): 1000 != %v\n", l)
+	}
+}
@@ -0,0 +1,418 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Summaries calculate targeted quantiles of a stream of float64 values, each
+// within a chosen rank error, over a trailing window of time.
+type Summary interface {
+	Clear()
+	Count() int64
+	Objectives() []SummaryObjective
+	Quantile(float64) float64
+	Quantiles([]float64) []float64
+	Sum() float64
+	Update(float64)
+}
+
+// SummaryObjective is a quantile tracked by a Summary and the rank error it
+// is tracked within. An objective of {0.99, 0.001} reports a value whose rank
+// is between the 98.9th and 99.1th percentile.
+type SummaryObjective struct {
+	Quantile float64
+	Error    float64
+}
+
+// DefaultSummaryObjectives are the quantiles tracked by a Summary when none
+// are chosen: the median within 5%, the 90th percentile within 1% and the
+// 99th percentile within 0.1%.
+var DefaultSummaryObjectives = []SummaryObjective{{0.5, 0.05}, {0.9, 0.01}, {0.99, 0.001}}
+
+const (
+	// DefaultSummaryMaxAge is the window of time the quantiles of a Summary
+	// reflect when none is chosen.
+	DefaultSummaryMaxAge = 10 * time.Minute
+
+	// DefaultSummaryAgeBuckets is the number of streams a Summary rotates
+	// through to expire old values when none is chosen.
+	DefaultSummaryAgeBuckets = 5
+
+	// summaryBufferSize is the number of values buffered before they are
+	// inserted into the streams of a Summary.
+	summaryBufferSize = 500
+)
+
+// NewSummary constructs a new StandardSummary configured by the given
+// options. It panics if an objective's quantile or error is not between 0
+// and 1, or the max age or number of age buckets is not positive.
+func NewSummary(opts ...SummaryOption) Summary {
+	s := &StandardSummary{
+		objectives: DefaultSummaryObjectives,
+		maxAge:     DefaultSummaryMaxAge,
+		ageBuckets: DefaultSummaryAgeBuckets,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for _, o := range s.objectives {
+		if o.Quantile <= 0 || o.Quantile >= 1 || o.Error <= 0 || o.Error >= 1 {
+			panic(fmt.Sprintf("metrics: invalid summary objective %v", o))
+		}
+	}
+	if s.maxAge <= 0 || s.ageBuckets < 1 {
+		panic(fmt.Sprintf("metrics: invalid summary age %v in %d buckets", s.maxAge, s.ageBuckets))
+	}
+	s.rotateEvery = s.maxAge / time.Duration(s.ageBuckets)
+	s.reset(time.Now())
+	return s
+}
+
+// NewRegisteredSummary constructs and registers a new StandardSummary
+// configured by the given options.
+func NewRegisteredSummary(name string, r Registry, opts ...SummaryOption) Summary {
+	c := NewSummary(opts...)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetSummary returns an existing Summary
+func GetSummary(name string, r Registry) Summary {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(Summary)
+}
+
+// SummaryOptions configure a StandardSummary built by NewSummary.
+type SummaryOption func(*StandardSummary)
+
+// WithSummaryObjectives sets the quantiles the summary tracks and outputs,
+// and the rank error each is tracked within.
+func WithSummaryObjectives(objectives ...SummaryObjective) SummaryOption {
+	return func(s *StandardSummary) {
+		s.objectives = make([]SummaryObjective, len(objectives))
+		copy(s.objectives, objectives)
+	}
+}
+
+// WithSummaryMaxAge sets the window of time the quantiles reflect, and the
+// number of age buckets it is divided into. Values expire one bucket at a
+// time, so the quantiles reflect between maxAge*(buckets-1)/buckets and
+// maxAge of values. More buckets expire values more smoothly at the cost of
+// more memory.
+func WithSummaryMaxAge(maxAge time.Duration, buckets int) SummaryOption {
+	return func(s *StandardSummary) {
+		s.maxAge = maxAge
+		s.ageBuckets = buckets
+	}
+}
+
+// StandardSummary is the standard implementation of a Summary. It tracks its
+// quantiles with the CKMS algorithm, keeping only as many values as its
+// objectives need. Each value is inserted into a stream for every age bucket,
+// started one bucket apart, and quantiles are read from the oldest stream,
+// which is restarted once it covers maxAge. The count and sum are not
+// limited to the window. See Cormode, Korn, Muthukrishnan and Srivastava's
+// "Effective Computation of Biased Quantiles over Data Streams".
+//
+// <https://www.cs.rutgers.edu/~muthu/bquant.pdf>
+type StandardSummary struct {
+	objectives  []SummaryObjective
+	maxAge      time.Duration
+	ageBuckets  int
+	rotateEvery time.Duration
+
+	mutex      sync.Mutex
+	streams    []*ckmsStream
+	head       int
+	headExpiry time.Time
+	buffer     []float64
+	count      int64
+	sum        float64
+	created    time.Time
+}
+
+// Clear clears the summary's streams, count and sum.
+func (s *StandardSummary) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reset(time.Now())
+}
+
+// Count returns the number of values ever recorded.
+func (s *StandardSummary) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Objectives returns the quantiles the summary tracks and outputs.
+func (s *StandardSummary) Objectives() []SummaryObjective {
+	objectives := make([]SummaryObjective, len(s.objectives))
+	copy(objectives, s.objectives)
+	return objectives
+}
+
+// Quantile returns an arbitrary quantile of the values recorded within the
+// summary's window. Only the quantiles of its objectives are within their
+// error; others may be less accurate.
+func (s *StandardSummary) Quantile(q float64) float64 {
+	return s.Quantiles([]float64{q})[0]
+}
+
+// Quantiles returns a slice of arbitrary quantiles of the values recorded
+// within the summary's window.
+func (s *StandardSummary) Quantiles(qs []float64) []float64 {
+	return s.quantilesAt(time.Now(), qs)
+}
+
+// Sum returns the sum of the values ever recorded.
+func (s *StandardSummary) Sum() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update records a new value. NaN, which has no rank among the values, is
+// ignored.
+func (s *StandardSummary) Update(v float64) {
+	s.update(time.Now(), v)
+}
+
+// MarshalMetric returns the count, sum and objective quantiles of the
+// summary, as output by the registry.
+func (s *StandardSummary) MarshalMetric() (interface{}, error) {
+	return summaryValue(s), nil
+}
+
+// createdTime returns the time the summary was created or last cleared.
+func (s *StandardSummary) createdTime() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.created
+}
+
+// summaryValue returns the values a Summary is output as. An infinite sum or
+// quantile is output as a string, as JSON has no infinities.
+func summaryValue(s Summary) map[string]interface{} {
+	objectives := s.Objectives()
+	quantiles := make([]float64, len(objectives))
+	for i, o := range objectives {
+		quantiles[i] = o.Quantile
+	}
+	qs := s.Quantiles(quantiles)
+	values := make(map[string]interface{})
+	values["count"] = s.Count()
+	values["sum"] = jsonFloat64(s.Sum())
+	for i, q := range quantiles {
+		values[percentileName(q)] = jsonFloat64(qs[i])
+	}
+	return values
+}
+
+func (s *StandardSummary) update(now time.Time, v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate(now)
+	s.buffer = append(s.buffer, v)
+	s.count++
+	s.sum += v
+	if len(s.buffer) == summaryBufferSize {
+		s.flush()
+	}
+}
+
+func (s *StandardSummary) quantilesAt(now time.Time, qs []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate(now)
+	s.flush()
+	values := make([]float64, len(qs))
+	for i, q := range qs {
+		values[i] = s.streams[s.head].query(q)
+	}
+	return values
+}
+
+// reset restarts every stream, the first expiring after a full maxAge.
+func (s *StandardSummary) reset(now time.Time) {
+	s.streams = make([]*ckmsStream, s.ageBuckets)
+	for i := range s.streams {
+		s.streams[i] = newCKMSStream(s.objectives)
+	}
+	s.head = 0
+	s.headExpiry = now.Add(s.maxAge)
+	s.buffer = s.buffer[:0]
+	s.count = 0
+	s.sum = 0
+	s.created = now
+}
+
+// rotate restarts the oldest stream for every age bucket that has passed
+// since it expired, making the next oldest stream the one queried.
+func (s *StandardSummary) rotate(now time.Time) {
+	if now.Before(s.headExpiry) {
+		return
+	}
+	s.flush()
+	for !now.Before(s.headExpiry) {
+		s.streams[s.head].reset()
+		s.head = (s.head + 1) % len(s.streams)
+		s.headExpiry = s.headExpiry.Add(s.rotateEvery)
+	}
+}
+
+// flush inserts the buffered values into every stream.
+func (s *StandardSummary) flush() {
+	if 0 == len(s.buffer) {
+		return
+	}
+	sort.Float64s(s.buffer)
+	for _, stream := range s.streams {
+		stream.insert(s.buffer)
+	}
+	s.buffer = s.buffer[:0]
+}
+
+// ckmsStream keeps the minimum number of values needed to answer its
+// targeted quantiles within their error. Each kept value covers width values
+// of the stream, and its rank is known within delta.
+type ckmsStream struct {
+	targets []SummaryObjective
+	n       float64
+	samples []ckmsSample
+}
+
+type ckmsSample struct {
+	value float64
+	width float64
+	delta float64
+}
+
+// newCKMSStream constructs a stream for the given objectives. The invariant
+// of the paper lets the values kept just below a target quantile be slightly
+// further apart than twice its error, so a query could miss by up to
+// error/(1-2*error/(1-quantile)). Each target's error is tightened by that
+// factor so queries stay within the objective.
+func newCKMSStream(objectives []SummaryObjective) *ckmsStream {
+	targets := make([]SummaryObjective, len(objectives))
+	for i, o := range objectives {
+		targets[i] = SummaryObjective{o.Quantile, o.Error / (1 + 2*o.Error/(1-o.Quantile))}
+	}
+	return &ckmsStream{targets: targets}
+}
+
+// allowedError returns the error in rank allowed for a value of rank r, the
+// tightest needed by any target.
+func (st *ckmsStream) allowedError(r float64) float64 {
+	allowed := math.MaxFloat64
+	for _, o := range st.targets {
+		var f float64
+		if o.Quantile*st.n <= r {
+			f = 2 * o.Error * r / o.Quantile
+		} else {
+			f = 2 * o.Error * (st.n - r) / (1 - o.Quantile)
+		}
+		allowed = math.Min(allowed, f)
+	}
+	return allowed
+}
+
+// insert adds sorted values to the stream and compresses it.
+func (st *ckmsStream) insert(values []float64) {
+	merged := make([]ckmsSample, 0, len(st.samples)+len(values))
+	var r float64
+	i := 0
+	for _, v := range values {
+		for i < len(st.samples) && st.samples[i].value <= v {
+			r += st.samples[i].width
+			merged = append(merged, st.samples[i])
+			i++
+		}
+		// Values inserted before or after every kept value know their rank
+		// exactly.
+		var delta float64
+		if len(merged) > 0 && i < len(st.samples) {
+			delta = math.Max(0, math.Floor(st.allowedError(r))-1)
+		}
+		merged = append(merged, ckmsSample{value: v, width: 1, delta: delta})
+		st.n++
+		r++
+	}
+	st.samples = append(merged, st.samples[i:]...)
+	st.compress()
+}
+
+// compress merges neighbouring samples whose combined width and delta remain
+// within the error allowed at their rank.
+func (st *ckmsStream) compress() {
+	if len(st.samples) < 3 {
+		return
+	}
+	// The lowest and highest values are always kept.
+	kept := []ckmsSample{st.samples[len(st.samples)-1]}
+	next := st.samples[len(st.samples)-2]
+	r := st.n - kept[0].width - next.width
+	for i := len(st.samples) - 3; i >= 0; i-- {
+		c := st.samples[i]
+		r -= c.width
+		if c.width+next.width+next.delta <= st.allowedError(r) && i > 0 {
+			// Fold c into next, which covers every value c did.
+			next.width += c.width
+			continue
+		}
+		kept = append(kept, next)
+		next = c
+	}
+	kept = append(kept, next)
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	st.samples = kept
+}
+
+// query returns the highest kept value whose rank is at most q*n plus half
+// the error allowed for q, or 0 if the stream is empty.
+func (st *ckmsStream) query(q float64) float64 {
+	if 0 == len(st.samples) {
+		return 0
+	}
+	t := math.Ceil(q * st.n)
+	allowed := st.allowedError(t)
+	for _, o := range st.targets {
+		if o.Quantile == q {
+			allowed = 2 * o.Error * st.n
+		}
+	}
+	t += math.Ceil(allowed / 2)
+	var r float64
+	prev := st.samples[0]
+	for _, c := range st.samples[1:] {
+		r += prev.width
+		if r+c.width+c.delta > t {
+			return prev.value
+		}
+		prev = c
+	}
+	return prev.value
+}
+
+func (st *ckmsStream) reset() {
+	st.n = 0
+	st.samples = st.samples[:0]
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func BenchmarkSummary(b *testing.B) {
+	s := NewSummary()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Update(float64(i))
+	}
+}
+
+// testSummaryObjectives checks that the rank of every objective's quantile is
+// within its error.
+func testSummaryObjectives(t *testing.T, s Summary, values []float64) {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	for _, o := range s.Objectives() {
+		v := s.Quantile(o.Quantile)
+		lowest := float64(sort.SearchFloat64s(sorted, v)) / float64(len(sorted))
+		highest := float64(sort.Search(len(sorted), func(i int) bool { return sorted[i] > v })) / float64(len(sorted))
+		if highest < o.Quantile-o.Error || lowest > o.Quantile+o.Error {
+			t.Errorf("%v quantile: %v has rank %v to %v, not within %v\n", o.Quantile, v, lowest, highest, o.Error)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s := NewSummary(WithSummaryObjectives(
+		SummaryObjective{0.5, 0.05},
+		SummaryObjective{0.9, 0.01},
+		SummaryObjective{0.99, 0.001},
+		SummaryObjective{0.999, 0.0001},
+	))
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = rand.ExpFloat64() * 1000
+		s.Update(values[i])
+	}
+	testSummaryObjectives(t, s, values)
+	if count := s.Count(); 100000 != count {
+		t.Errorf("s.Count(): 100000 != %v\n", count)
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	if math.Abs(s.Sum()-sum) > 1e-6*sum {
+		t.Errorf("s.Sum(): %v != %v\n", sum, s.Sum())
+	}
+	// Only the values needed for the objectives are kept.
+	st := s.(*StandardSummary).streams[0]
+	if size := len(st.samples); size > 2000 {
+		t.Errorf("len(st.samples): %v > 2000\n", size)
+	}
+}
+
+func TestSummarySorted(t *testing.T) {
+	for _, descending := range []bool{false, true} {
+		s := NewSummary()
+		values := make([]float64, 20000)
+		for i := range values {
+			values[i] = float64(i)
+			if descending {
+				values[i] = float64(len(values) - i)
+			}
+			s.Update(values[i])
+		}
+		testSummaryObjectives(t, s, values)
+	}
+}
+
+func TestSummaryEmpty(t *testing.T) {
+	s := NewSummary()
+	if q := s.Quantile(0.5); 0 != q {
+		t.Errorf("s.Quantile(0.5): 0 != %v\n", q)
+	}
+	s.Update(1)
+	s.Clear()
+	if count, q := s.Count(), s.Quantile(0.5); 0 != count || 0 != q {
+		t.Errorf("s.Count(), s.Quantile(0.5) after clear: %v, %v\n", count, q)
+	}
+}
+
+func TestSummaryMaxAge(t *testing.T) {
+	s := NewSummary(WithSummaryMaxAge(time.Minute, 3)).(*StandardSummary)
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		s.update(now, 1000)
+	}
+	if q := s.quantilesAt(now.Add(59*time.Second), []float64{0.5})[0]; 1000 != q {
+		t.Errorf("median after 59s: 1000 != %v\n", q)
+	}
+	for i := 0; i < 1000; i++ {
+		s.update(now.Add(61*time.Second), 10)
+	}
+	// The streams started with the summary expire 20s apart, after which
+	// the oldest stream was restarted after the first values.
+	if q := s.quantilesAt(now.Add(101*time.Second), []float64{0.5})[0]; 10 != q {
+		t.Errorf("median after 101s: 10 != %v\n", q)
+	}
+	if q := s.quantilesAt(now.Add(3*time.Minute), []float64{0.5})[0]; 0 != q {
+		t.Errorf("median after 3m: 0 != %v\n", q)
+	}
+	if count := s.Count(); 2000 != count {
+		t.Errorf("s.Count(): 2000 != %v\n", count)
+	}
+}
+
+func TestSummaryInvalid(t *testing.T) {
+	for _, opt := range []SummaryOption{
+		WithSummaryObjectives(SummaryObjective{1, 0.01}),
+		WithSummaryObjectives(SummaryObjective{0.5, 0}),
+		WithSummaryMaxAge(0, 5),
+		WithSummaryMaxAge(time.Minute, 0),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewSummary() did not panic\n")
+				}
+			}()
+			NewSummary(opt)
+		}()
+	}
+}
+
+func TestGetSummary(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredSummary("foo", r).Update(47)
+	if s := GetSummary("foo", r); 1 != s.Count() {
+		t.Fatal(s)
+	}
+}
+
+func TestRegistrySummary(t *testing.T) {
+	r := NewRegistry()
+	s := NewRegisteredSummary("latency", r, WithSummaryObjectives(SummaryObjective{0.5, 0.01}, SummaryObjective{0.9999, 0.00001}))
+	for i := 1; i <= 100; i++ {
+		s.Update(float64(i))
+	}
+	values := registryValues(t, r)["latency"].(map[string]interface{})
+	if count := values["count"]; 100.0 != count {
+		t.Errorf("count: 100 != %v\n", count)
+	}
+	if sum := values["sum"]; 5050.0 != sum {
+		t.Errorf("sum: 5050 != %v\n", sum)
+	}
+	if median := values["median"].(float64); math.Abs(50-median) > 1 {
+		t.Errorf("median: 50 != %v\n", median)
+	}
+	if p := values["99.99%"]; 100.0 != p {
+		t.Errorf("99.99%%: 100 != %v\n", p)
+	}
+}
+
+func TestRegistrySummaryNonFinite(t *testing.T) {
+	r := NewRegistry()
+	s := NewRegisteredSummary("latency", r, WithSummaryObjectives(SummaryObjective{0.5, 0.01}))
+	s.Update(1)
+	s.Update(math.NaN())
+	if count := s.Count(); 1 != count {
+		t.Errorf("s.Count(): 1 != %v\n", count)
+	}
+	s.Update(math.Inf(1))
+	s.Update(math.Inf(1))
+	values := registryValues(t, r)["latency"].(map[string]interface{})
+	if sum := values["sum"]; "+Inf" != sum {
+		t.Errorf("sum: +Inf != %v\n", sum)
+	}
+	if median := values["median"]; "+Inf" != median {
+		t.Errorf("median: +Inf != %v\n", median)
+	}
+}
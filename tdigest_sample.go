@@ -0,0 +1,384 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultTDigestCompression is a t-digest compression that keeps percentiles
+// within a fraction of a percent while holding a few hundred centroids.
+const DefaultTDigestCompression = 100
+
+// The compressions of a t-digest at least and, when decoded, at most. The
+// buffer of a digest holds five times its compression in centroids, so a
+// decoded digest with an implausibly large compression is rejected rather
+// than allocated.
+const (
+	minTDigestCompression = 10
+	maxTDigestCompression = 100000
+)
+
+// TDigestSample is a sample backed by a merging t-digest, which summarises
+// every recorded value in a bounded number of centroids that are smallest
+// near the extreme percentiles. Unlike a reservoir, digests recorded by
+// different registries or processes can be merged into one with Merge.
+// Count, Min, Max, Sum and Mean are exact. See Dunning and Ertl's "Computing
+// Extremely Accurate Quantiles Using t-Digests".
+//
+// <https://arxiv.org/abs/1902.04023>
+type TDigestSample struct {
+	compression float64
+	mutex       sync.Mutex
+	centroids   []tdigestCentroid
+	buffer      []tdigestCentroid
+	scratch     []tdigestCentroid
+	count       int64
+	min, max    int64
+	sum         int64
+	mean, m2    float64
+}
+
+// tdigestCentroid is the mean of count values that are close to each other.
+type tdigestCentroid struct {
+	mean  float64
+	count int64
+}
+
+// NewTDigestSample constructs a new t-digest sample with the given
+// compression. Higher compressions are more accurate and use more memory,
+// DefaultTDigestCompression suits most uses.
+func NewTDigestSample(compression float64) Sample {
+	if compression < minTDigestCompression {
+		compression = minTDigestCompression
+	}
+	s := &TDigestSample{compression: compression}
+	s.buffer = make([]tdigestCentroid, 0, 5*int(math.Ceil(compression)))
+	s.reset()
+	return s
+}
+
+// Clear clears all samples.
+func (s *TDigestSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.centroids = s.centroids[:0]
+	s.buffer = s.buffer[:0]
+	s.reset()
+}
+
+// Count returns the number of samples recorded.
+func (s *TDigestSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value ever recorded.
+func (s *TDigestSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == s.count {
+		return 0
+	}
+	return s.max
+}
+
+// Mean returns the mean of the recorded values.
+func (s *TDigestSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.mean
+}
+
+// Merge adds the values recorded by another TDigestSample to this sample.
+// It returns an error wrapping ErrIncompatibleSample if other is not a
+// TDigestSample.
+func (s *TDigestSample) Merge(other Sample) error {
+	o, ok := other.(*TDigestSample)
+	if !ok {
+		return fmt.Errorf("%w: cannot merge %T into %T", ErrIncompatibleSample, other, s)
+	}
+	if o == s {
+		return fmt.Errorf("%w: cannot merge a sample into itself", ErrIncompatibleSample)
+	}
+	o.mutex.Lock()
+	o.compress()
+	centroids := make([]tdigestCentroid, len(o.centroids))
+	copy(centroids, o.centroids)
+	count, min, max, sum, mean, m2 := o.count, o.min, o.max, o.sum, o.mean, o.m2
+	o.mutex.Unlock()
+
+	if 0 == count {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range centroids {
+		s.add(c)
+	}
+	s.combineStats(count, min, max, sum, mean, m2)
+	return nil
+}
+
+// Min returns the minimum value ever recorded.
+func (s *TDigestSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == s.count {
+		return 0
+	}
+	return s.min
+}
+
+// Percentile returns an arbitrary percentile of the recorded values.
+func (s *TDigestSample) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the recorded
+// values.
+func (s *TDigestSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.compress()
+	scores := make([]float64, len(ps))
+	if 0 == s.count {
+		return scores
+	}
+	for i, p := range ps {
+		scores[i] = s.quantile(p)
+	}
+	return scores
+}
+
+// Size returns the number of centroids summarising the recorded values.
+func (s *TDigestSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.compress()
+	return len(s.centroids)
+}
+
+// StdDev returns the standard deviation of the recorded values.
+func (s *TDigestSample) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the recorded values.
+func (s *TDigestSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update records a new value.
+func (s *TDigestSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.add(tdigestCentroid{mean: float64(v), count: 1})
+	s.combineStats(1, v, v, v, float64(v), 0)
+}
+
+// Values returns the mean of each centroid, rounded to the nearest integer,
+// from lowest to highest.
+func (s *TDigestSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.compress()
+	values := make([]int64, len(s.centroids))
+	for i, c := range s.centroids {
+		values[i] = int64(math.Round(c.mean))
+	}
+	return values
+}
+
+// Variance returns the variance of the recorded values.
+func (s *TDigestSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 == s.count {
+		return 0.0
+	}
+	return s.m2 / float64(s.count)
+}
+
+// MarshalBinary encodes the digest in a compact form that can be decoded by
+// UnmarshalBinary or DecodeSample, for example in another process.
+func (s *TDigestSample) MarshalBinary() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.compress()
+	b := make([]byte, 0, 64+10*len(s.centroids))
+	b = append(b, sampleKindTDigest)
+	b = appendFloat64(b, s.compression)
+	b = binary.AppendVarint(b, s.count)
+	b = binary.AppendVarint(b, s.min)
+	b = binary.AppendVarint(b, s.max)
+	b = binary.AppendVarint(b, s.sum)
+	b = appendFloat64(b, s.mean)
+	b = appendFloat64(b, s.m2)
+	b = binary.AppendUvarint(b, uint64(len(s.centroids)))
+	for _, c := range s.centroids {
+		b = appendFloat64(b, c.mean)
+		b = binary.AppendVarint(b, c.count)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary replaces the digest with one encoded by MarshalBinary.
+func (s *TDigestSample) UnmarshalBinary(b []byte) error {
+	d := sampleDecoder{b: b}
+	if kind := d.byte(); kind != sampleKindTDigest && d.err == nil {
+		return fmt.Errorf("%w: not a t-digest", ErrInvalidSampleEncoding)
+	}
+	compression := d.float64()
+	count, min, max, sum := d.varint(), d.varint(), d.varint(), d.varint()
+	mean, m2 := d.float64(), d.float64()
+	n := d.length(9)
+	centroids := make([]tdigestCentroid, 0, n)
+	for i := 0; i < n; i++ {
+		centroids = append(centroids, tdigestCentroid{mean: d.float64(), count: d.varint()})
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if math.IsNaN(compression) || compression < minTDigestCompression || compression > maxTDigestCompression {
+		return fmt.Errorf("%w: invalid t-digest compression %v", ErrInvalidSampleEncoding, compression)
+	}
+	var total int64
+	for _, c := range centroids {
+		if c.count < 1 || c.count > count-total || math.IsNaN(c.mean) || math.IsInf(c.mean, 0) {
+			return fmt.Errorf("%w: invalid t-digest centroid", ErrInvalidSampleEncoding)
+		}
+		total += c.count
+	}
+	if total != count {
+		return fmt.Errorf("%w: t-digest centroids count %d values, not %d", ErrInvalidSampleEncoding, total, count)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.compression = compression
+	s.centroids = centroids
+	s.buffer = make([]tdigestCentroid, 0, 5*int(math.Ceil(compression)))
+	s.scratch = nil
+	s.count, s.min, s.max, s.sum, s.mean, s.m2 = count, min, max, sum, mean, m2
+	return nil
+}
+
+func (s *TDigestSample) reset() {
+	s.count = 0
+	s.sum = 0
+	s.min = math.MaxInt64
+	s.max = math.MinInt64
+	s.mean = 0
+	s.m2 = 0
+}
+
+// add buffers a centroid, merging the buffer into the digest once full.
+func (s *TDigestSample) add(c tdigestCentroid) {
+	if len(s.buffer) == cap(s.buffer) {
+		s.compress()
+	}
+	s.buffer = append(s.buffer, c)
+}
+
+// combineStats folds the exact statistics of count other values into the
+// sample, using Chan et al's parallel algorithm for the variance.
+func (s *TDigestSample) combineStats(count, min, max, sum int64, mean, m2 float64) {
+	total := s.count + count
+	delta := mean - s.mean
+	s.mean += delta * float64(count) / float64(total)
+	s.m2 += m2 + delta*delta*float64(s.count)*float64(count)/float64(total)
+	s.count = total
+	s.sum += sum
+	if min < s.min {
+		s.min = min
+	}
+	if max > s.max {
+		s.max = max
+	}
+}
+
+// compress merges the buffered centroids into the digest, combining
+// neighbouring centroids as long as the k1 scale function allows.
+func (s *TDigestSample) compress() {
+	if 0 == len(s.buffer) {
+		return
+	}
+	all := append(s.centroids, s.buffer...)
+	s.buffer = s.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	var total int64
+	for _, c := range all {
+		total += c.count
+	}
+	merged := s.scratch[:0]
+	cur := all[0]
+	var weightSoFar int64
+	qLimit := s.qLimit(0)
+	for _, c := range all[1:] {
+		q := float64(weightSoFar+cur.count+c.count) / float64(total)
+		if q <= qLimit {
+			cur.count += c.count
+			cur.mean += (c.mean - cur.mean) * float64(c.count) / float64(cur.count)
+			continue
+		}
+		weightSoFar += cur.count
+		merged = append(merged, cur)
+		cur = c
+		qLimit = s.qLimit(float64(weightSoFar) / float64(total))
+	}
+	merged = append(merged, cur)
+	s.centroids, s.scratch = merged, all[:0]
+}
+
+// qLimit returns the highest quantile a centroid starting at quantile q may
+// reach, so that it spans at most one unit of the k1 scale function.
+func (s *TDigestSample) qLimit(q float64) float64 {
+	k := s.compression / (2 * math.Pi) * math.Asin(2*q-1)
+	k++
+	if k >= s.compression/4 {
+		return 1
+	}
+	return (1 + math.Sin(2*math.Pi*k/s.compression)) / 2
+}
+
+// quantile interpolates the value at quantile p between the centres of the
+// centroids, and the exact minimum and maximum at either end.
+func (s *TDigestSample) quantile(p float64) float64 {
+	if p <= 0 {
+		return float64(s.min)
+	}
+	if p >= 1 {
+		return float64(s.max)
+	}
+	target := p * float64(s.count)
+	first := s.centroids[0]
+	if target < float64(first.count)/2 {
+		if 1 == first.count {
+			return float64(s.min)
+		}
+		return float64(s.min) + (first.mean-float64(s.min))*target/(float64(first.count)/2)
+	}
+	var cumulative float64
+	for i := 0; i < len(s.centroids)-1; i++ {
+		c, next := s.centroids[i], s.centroids[i+1]
+		centre := cumulative + float64(c.count)/2
+		nextCentre := cumulative + float64(c.count) + float64(next.count)/2
+		if target < nextCentre {
+			return c.mean + (next.mean-c.mean)*(target-centre)/(nextCentre-centre)
+		}
+		cumulative += float64(c.count)
+	}
+	last := s.centroids[len(s.centroids)-1]
+	centre := float64(s.count) - float64(last.count)/2
+	if 1 == last.count || target <= centre {
+		return math.Min(last.mean, float64(s.max))
+	}
+	return last.mean + (float64(s.max)-last.mean)*(target-centre)/(float64(last.count)/2)
+}
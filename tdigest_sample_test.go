@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func BenchmarkTDigestSample(b *testing.B) {
+	benchmarkSample(b, NewTDigestSample(DefaultTDigestCompression))
+}
+
+// testTDigestPercentiles checks the percentiles of the sample against the
+// exact percentiles of the values, by the rank of each estimate.
+func testTDigestPercentiles(t *testing.T, s Sample, values []int64) {
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ps := []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999}
+	scores := s.Percentiles(ps)
+	for i, p := range ps {
+		rank := float64(sort.Search(len(sorted), func(j int) bool { return float64(sorted[j]) >= scores[i] })) / float64(len(sorted))
+		// Centroids of the default compression span about 0.03*sqrt(p(1-p))
+		// of the values, so the digest is most accurate at the extremes.
+		maxError := 0.001 + 0.03*math.Sqrt(p*(1-p))
+		if math.Abs(rank-p) > maxError {
+			t.Errorf("%v percentile: %v has rank %v\n", p, scores[i], rank)
+		}
+	}
+	if min := s.Min(); sorted[0] != min {
+		t.Errorf("s.Min(): %v != %v\n", sorted[0], min)
+	}
+	if max := s.Max(); sorted[len(sorted)-1] != max {
+		t.Errorf("s.Max(): %v != %v\n", sorted[len(sorted)-1], max)
+	}
+	if count := s.Count(); int64(len(values)) != count {
+		t.Errorf("s.Count(): %v != %v\n", len(values), count)
+	}
+	if sum := s.Sum(); SampleSum(values) != sum {
+		t.Errorf("s.Sum(): %v != %v\n", SampleSum(values), sum)
+	}
+	if stdDev := s.StdDev(); math.Abs(SampleStdDev(values)-stdDev) > 1e-6*stdDev {
+		t.Errorf("s.StdDev(): %v != %v\n", SampleStdDev(values), stdDev)
+	}
+}
+
+func randomValues(n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = int64(rand.ExpFloat64() * 1000000)
+	}
+	return values
+}
+
+func TestTDigestSample(t *testing.T) {
+	s := NewTDigestSample(DefaultTDigestCompression)
+	values := randomValues(100000)
+	for _, v := range values {
+		s.Update(v)
+	}
+	testTDigestPercentiles(t, s, values)
+	if size := s.Size(); size > 2*DefaultTDigestCompression {
+		t.Errorf("s.Size(): %v > %v\n", size, 2*DefaultTDigestCompression)
+	}
+}
+
+func TestTDigestSampleSmall(t *testing.T) {
+	s := NewTDigestSample(DefaultTDigestCompression)
+	for _, v := range []int64{5, 1, 3} {
+		s.Update(v)
+	}
+	if ps := s.Percentiles([]float64{0, 0.5, 1}); 1 != ps[0] || 3 != ps[1] || 5 != ps[2] {
+		t.Errorf("s.Percentiles(): [1 3 5] != %v\n", ps)
+	}
+	if mean := s.Mean(); 3 != mean {
+		t.Errorf("s.Mean(): 3 != %v\n", mean)
+	}
+}
+
+func TestTDigestSampleEmpty(t *testing.T) {
+	s := NewTDigestSample(DefaultTDigestCompression)
+	if p := s.Percentile(0.5); 0 != p {
+		t.Errorf("s.Percentile(0.5): 0 != %v\n", p)
+	}
+	if min, max := s.Min(), s.Max(); 0 != min || 0 != max {
+		t.Errorf("s.Min(), s.Max(): %v, %v\n", min, max)
+	}
+	s.Update(7)
+	s.Clear()
+	if count, size := s.Count(), s.Size(); 0 != count || 0 != size {
+		t.Errorf("s.Count(), s.Size() after clear: %v, %v\n", count, size)
+	}
+}
+
+func TestTDigestSampleMerge(t *testing.T) {
+	merged := NewTDigestSample(DefaultTDigestCompression).(MergeableSample)
+	var all []int64
+	for i := 0; i < 4; i++ {
+		s := NewTDigestSample(DefaultTDigestCompression)
+		values := randomValues(25000)
+		for _, v := range values {
+			s.Update(v)
+		}
+		all = append(all, values...)
+		if err := merged.Merge(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testTDigestPercentiles(t, merged, all)
+}
+
+func TestTDigestSampleMergeIncompatible(t *testing.T) {
+	s := NewTDigestSample(DefaultTDigestCompression).(MergeableSample)
+	if err := s.Merge(NewUniformSample(10)); !errors.Is(err, ErrIncompatibleSample) {
+		t.Errorf("s.Merge(UniformSample): %v", err)
+	}
+	if err := s.Merge(s); !errors.Is(err, ErrIncompatibleSample) {
+		t.Errorf("s.Merge(s): %v", err)
+	}
+}
+
+func TestTDigestSampleEncoding(t *testing.T) {
+	s := NewTDigestSample(DefaultTDigestCompression)
+	values := randomValues(10000)
+	for _, v := range values {
+		s.Update(v)
+	}
+	b, err := s.(MergeableSample).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(b); l > 4096 {
+		t.Errorf("len(s.MarshalBinary()): %d > 4096\n", l)
+	}
+	decoded, err := DecodeSample(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTDigestPercentiles(t, decoded, values)
+	if p, d := s.Percentile(0.99), decoded.Percentile(0.99); p != d {
+		t.Errorf("decoded.Percentile(0.99): %v != %v\n", p, d)
+	}
+
+	for _, invalid := range [][]byte{nil, {0}, b[:len(b)-1], append(b, 0)} {
+		if _, err := DecodeSample(invalid); !errors.Is(err, ErrInvalidSampleEncoding) {
+			t.Errorf("DecodeSample(%v...): %v\n", invalid[:min(len(invalid), 4)], err)
+		}
+	}
+}
+
+func TestTDigestSampleDecodeCorrupt(t *testing.T) {
+	s := NewTDigestSample(DefaultTDigestCompression).(*TDigestSample)
+	for _, v := range randomValues(1000) {
+		s.Update(v)
+	}
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, compression := range []float64{-1, 0, math.NaN(), math.Inf(1), 1e12} {
+		corrupt := append([]byte{}, b...)
+		binary.LittleEndian.PutUint64(corrupt[1:], math.Float64bits(compression))
+		if _, err := DecodeSample(corrupt); !errors.Is(err, ErrInvalidSampleEncoding) {
+			t.Errorf("DecodeSample() with compression %v: %v\n", compression, err)
+		}
+	}
+
+	s.count++
+	b, err = s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeSample(b); !errors.Is(err, ErrInvalidSampleEncoding) {
+		t.Errorf("DecodeSample() with a count the centroids do not add up to: %v\n", err)
+	}
+}
+
+func TestHistogramMergeAcrossRegistries(t *testing.T) {
+	var all []int64
+	aggregate := NewHistogram(NewTDigestSample(DefaultTDigestCompression))
+	for i := 0; i < 3; i++ {
+		r := NewRegistry()
+		h := NewRegisteredHistogram("latency", r, NewTDigestSample(DefaultTDigestCompression))
+		values := randomValues(10000)
+		for _, v := range values {
+			h.Update(v)
+		}
+		all = append(all, values...)
+
+		// Decode the histogram from the output of the registry, as another
+		// process would.
+		encoded := registryValues(t, r)["latency"].(map[string]interface{})["sample"].(string)
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := DecodeSample(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := aggregate.Merge(NewHistogram(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testTDigestPercentiles(t, aggregate.Sample(), all)
+}
+
+func TestHistogramMergeUnmergeable(t *testing.T) {
+	h := NewHistogram(NewUniformSample(10))
+	if err := h.Merge(NewHistogram(NewUniformSample(10))); !errors.Is(err, ErrIncompatibleSample) {
+		t.Errorf("h.Merge(): %v", err)
+	}
+}
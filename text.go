@@ -1,6 +1,9 @@
 package metrics
 
-import "os"
+import (
+	"os"
+	"sync"
+)
 
 // Text is a basic string message that can be set and appended to
 type Text interface {
@@ -12,7 +15,7 @@ type Text interface {
 
 // NewCounter constructs a new StandardText.
 func NewText() Text {
-	return &StandardText{""}
+	return &StandardText{}
 }
 
 // NewRegisteredCounter constructs and registers a new StandardText.
@@ -21,7 +24,7 @@ func NewRegisteredText(name string, r Registry) Text {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, t)
+	err := registerCreated(r, name, t)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -36,27 +39,42 @@ func GetText(name string, r Registry) Text {
 	return r.Get(name).(Text)
 }
 
-// StandardText is the standard implementation of a text value
+// StandardText is the standard implementation of a text value and is safe
+// for concurrent use.
 type StandardText struct {
-	msg string
+	mutex sync.RWMutex
+	msg   string
 }
 
 // Clear removes the current msg value
 func (t *StandardText) Clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.msg = ""
 }
 
 // Text returns the msg value
 func (t *StandardText) Text() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
 	return t.msg
 }
 
 // Set changes the msg value to the indicated string
 func (t *StandardText) Set(str string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.msg = str
 }
 
 // Append adds the indicated string to the end of the msg value
 func (t *StandardText) Append(str string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.msg += str
 }
+
+// MarshalMetric returns the msg value, as output by the registry.
+func (t *StandardText) MarshalMetric() (interface{}, error) {
+	return t.Text(), nil
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"math/rand"
+	"sync"
 	"testing"
 )
 
@@ -60,3 +61,22 @@ func TestGetText(t *testing.T) {
 		t.Fatal(tx)
 	}
 }
+
+func TestTextConcurrent(t *testing.T) {
+	tx := NewText()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tx.Append("a")
+				tx.Text()
+			}
+		}()
+	}
+	wg.Wait()
+	if l := len(tx.Text()); 1000 != l {
+		t.Errorf("len(tx.Text()): 1000 != %v\n", l)
+	}
+}
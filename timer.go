@@ -1,24 +1,44 @@
 package metrics
 
 import (
-	"math"
 	"os"
 	"sync"
 	"time"
 )
 
+// DefaultTimerUnit is the unit timers are output in when neither the timer
+// nor its registry choose one.
+const DefaultTimerUnit = time.Second
+
 // Timers measures the time to complete a task and tracks the
 // history of past executions
 type Timer interface {
-	Count() int64             // Number of timer executions
-	Max() int64               // Highest recorded timer execution in seconds
-	Mean() float64            // Mean recorded timer execution in seconds
-	Min() int64               // Lowest recorded timer execution in seconds
-	LastValue() float64       // The value from the most recent execution in seconds
-	AllExecutions() []float64 // All past executions in seconds
-	Start()                   // Record current time
-	Stop()                    // Record duration since Start() call
-	Time(func())              // Record duration to execute a function
+	Count() int64                          // Number of timer executions
+	Max() time.Duration                    // Longest recorded timer execution
+	Mean() time.Duration                   // Mean recorded timer execution
+	Min() time.Duration                    // Shortest recorded timer execution
+	Percentile(float64) time.Duration      // Arbitrary percentile of recorded timer executions
+	Percentiles([]float64) []time.Duration // Arbitrary percentiles of recorded timer executions
+	StdDev() time.Duration                 // Standard deviation of recorded timer executions
+	Sum() time.Duration                    // Sum of recorded timer executions
+	Rate() Meter                           // Read-only snapshot of the rate of timer executions
+	LastValue() time.Duration              // The duration of the most recent execution
+	AllExecutions() []time.Duration        // Past executions kept by the retention policy
+	Unit() time.Duration                   // Unit used to output the timer, 0 if the registry's unit is used
+	SetUnit(time.Duration)                 // Set the unit used to output the timer
+	Begin() TimerContext                   // Start timing a span that is recorded when it is stopped
+	Start()                                // Record current time
+	Stop()                                 // Record duration since Start() call
+	StopMeter()                            // Stop ticking the rate of executions
+	Time(func())                           // Record duration to execute a function
+	Update(time.Duration)                  // Record the duration of an event
+	UpdateSince(time.Time)                 // Record duration since the given time
+}
+
+// TimerContexts time a single span started by Timer.Begin, independently of
+// any other span timed by the same Timer.
+type TimerContext interface {
+	Stop() time.Duration // Record and return the duration since Begin() was called
 }
 
 // NewRegisteredTimer constructs and registers a new StandardTimer.
@@ -29,7 +49,23 @@ func NewRegisteredTimer(name string, r Registry) Timer {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	err := r.Register(name, c)
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// NewRegisteredTimerWithOptions constructs and registers a new StandardTimer
+// configured by the given options.
+// Be sure to unregister the timer from the registry once it is of no use to
+// allow for garbage collection.
+func NewRegisteredTimerWithOptions(name string, r Registry, opts ...TimerOption) Timer {
+	c := NewTimerWithOptions(opts...)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
@@ -37,12 +73,56 @@ func NewRegisteredTimer(name string, r Registry) Timer {
 }
 
 // NewTimer constructs a new StandardTimer using an exponentially-decaying
-// sample with the same reservoir size and alpha as UNIX load averages.
-// Be sure to call Cleanup() once the timer is of no use to allow for garbage collection.
+// sample with the same reservoir size and alpha as UNIX load averages, that
+// keeps the DefaultTimerHistory most recent executions.
+// Be sure to call StopMeter() once the timer is of no use to allow for
+// garbage collection, unless it was registered with GetOrRegister, which
+// stops it when it is unregistered. A registry does not stop the timers
+// passed to Register.
 func NewTimer() Timer {
-	return &StandardTimer{
+	return NewTimerWithOptions()
+}
+
+// NewTimerWithOptions constructs a new StandardTimer configured by the given
+// options. Options that are not given take the same defaults as NewTimer.
+// Be sure to call StopMeter() once the timer is of no use to allow for
+// garbage collection, unless it was registered with GetOrRegister.
+func NewTimerWithOptions(opts ...TimerOption) Timer {
+	t := &StandardTimer{
 		histogram: NewHistogram(NewExpDecaySample(1028, 0.015)),
 		meter:     NewMeter(),
+		retention: RetainLast(DefaultTimerHistory),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// TimerOptions configure a StandardTimer built by NewTimerWithOptions.
+type TimerOption func(*StandardTimer)
+
+// WithTimerRetention sets the policy deciding which past executions the
+// timer keeps.
+func WithTimerRetention(p RetentionPolicy) TimerOption {
+	return func(t *StandardTimer) {
+		t.retention = p
+	}
+}
+
+// WithTimerSample sets the sample the timer's durations are recorded in, such
+// as NewSlidingTimeWindowSample(5 * time.Minute) to report on the last five
+// minutes only.
+func WithTimerSample(s Sample) TimerOption {
+	return func(t *StandardTimer) {
+		t.histogram = NewHistogram(s)
+	}
+}
+
+// WithTimerUnit sets the unit the timer is output in.
+func WithTimerUnit(unit time.Duration) TimerOption {
+	return func(t *StandardTimer) {
+		t.unit = unit
 	}
 }
 
@@ -55,13 +135,17 @@ func GetTimer(name string, r Registry) Timer {
 }
 
 // StandardTimer is the standard implementation of a Timer and uses a Histogram
-// and Meter.
+// and Meter. Durations are recorded with nanosecond precision and only
+// converted to the timer's unit when it is output.
 type StandardTimer struct {
 	histogram  Histogram
 	meter      Meter
-	executions []float64
+	executions []TimerExecution
+	retention  RetentionPolicy
 	startTime  time.Time
-	lastValue  float64
+	lastValue  time.Duration
+	sum        time.Duration
+	unit       time.Duration
 	mutex      sync.Mutex
 }
 
@@ -71,31 +155,100 @@ func (t *StandardTimer) Count() int64 {
 }
 
 // Max returns the maximum value in the sample.
-func (t *StandardTimer) Max() int64 {
-	return t.histogram.Max()
+func (t *StandardTimer) Max() time.Duration {
+	return time.Duration(t.histogram.Max())
 }
 
 // Mean returns the mean of the values in the sample.
-func (t *StandardTimer) Mean() float64 {
-	return t.histogram.Mean()
+func (t *StandardTimer) Mean() time.Duration {
+	return time.Duration(t.histogram.Mean())
 }
 
 // Min returns the minimum value in the sample.
-func (t *StandardTimer) Min() int64 {
-	return t.histogram.Min()
+func (t *StandardTimer) Min() time.Duration {
+	return time.Duration(t.histogram.Min())
+}
+
+// Percentile returns an arbitrary percentile of the values in the sample.
+func (t *StandardTimer) Percentile(p float64) time.Duration {
+	return time.Duration(t.histogram.Percentile(p))
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the
+// sample.
+func (t *StandardTimer) Percentiles(ps []float64) []time.Duration {
+	values := t.histogram.Percentiles(ps)
+	durations := make([]time.Duration, len(values))
+	for i, v := range values {
+		durations[i] = time.Duration(v)
+	}
+	return durations
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (t *StandardTimer) StdDev() time.Duration {
+	return time.Duration(t.histogram.StdDev())
+}
+
+// Sum returns the sum of the durations of every event recorded, not only of
+// those kept by the sample, so that it goes with Count.
+func (t *StandardTimer) Sum() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.sum
+}
+
+// Rate returns a read-only copy of the meter tracking how often the timer
+// records an execution.
+func (t *StandardTimer) Rate() Meter {
+	return t.meter.Snapshot()
 }
 
 // LastValue returns the value from the most recent execution.
-func (t *StandardTimer) LastValue() float64 {
+func (t *StandardTimer) LastValue() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	return t.lastValue
 }
 
-// AllExecutions returns all the past executions
-func (t *StandardTimer) AllExecutions() []float64 {
-	return t.executions
+// AllExecutions returns the past executions kept by the timer's retention
+// policy, from oldest to newest.
+func (t *StandardTimer) AllExecutions() []time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.executions = t.retention.Retain(t.executions, time.Now())
+	executions := make([]time.Duration, len(t.executions))
+	for i, e := range t.executions {
+		executions[i] = e.Duration
+	}
+	return executions
+}
+
+// Unit returns the unit the timer is output in, or 0 if the timer is output
+// in the unit of the registry it belongs to.
+func (t *StandardTimer) Unit() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.unit
 }
 
-// Record the current time to prepare for a Stop() call
+// SetUnit sets the unit the timer is output in, such as time.Millisecond.
+// A unit of 0 outputs the timer in the unit of the registry it belongs to.
+func (t *StandardTimer) SetUnit(unit time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.unit = unit
+}
+
+// Begin starts timing a span and returns a TimerContext that records it when
+// stopped. Unlike Start() and Stop(), spans started by Begin() can overlap, so
+// a single timer can be shared between goroutines.
+func (t *StandardTimer) Begin() TimerContext {
+	return &timerContext{timer: t, start: time.Now()}
+}
+
+// Record the current time to prepare for a Stop() call. A timer only holds
+// one start time, use Begin() to time spans that may overlap.
 func (t *StandardTimer) Start() {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -104,7 +257,18 @@ func (t *StandardTimer) Start() {
 
 // Record the duration of an event that started with a call to Start() and ends now.
 func (t *StandardTimer) Stop() {
-	t.update(time.Since(t.startTime))
+	t.mutex.Lock()
+	startTime := t.startTime
+	t.mutex.Unlock()
+	t.update(time.Since(startTime))
+}
+
+// StopMeter stops ticking the moving average rates of executions, so that a
+// timer that is of no use can be garbage collected. The timer still records
+// durations, and is stopped by a registry that created it when it is
+// unregistered.
+func (t *StandardTimer) StopMeter() {
+	t.meter.Stop()
 }
 
 // Record the duration of the execution of the given function.
@@ -114,12 +278,115 @@ func (t *StandardTimer) Time(f func()) {
 	t.update(time.Since(ts))
 }
 
+// Update records the duration of an event.
+func (t *StandardTimer) Update(d time.Duration) {
+	t.update(d)
+}
+
+// UpdateSince records the duration of an event that started at the given
+// time and ends now.
+func (t *StandardTimer) UpdateSince(ts time.Time) {
+	t.update(time.Since(ts))
+}
+
 // Record the duration of an event.
 func (t *StandardTimer) update(d time.Duration) {
+	t.record(time.Now(), d)
+}
+
+// record records the duration of an event that ended at a particular
+// timestamp.  This is a method all its own to facilitate testing.
+func (t *StandardTimer) record(now time.Time, d time.Duration) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	t.histogram.Update(int64(d.Seconds()))
+	t.histogram.Update(int64(d))
 	t.meter.Mark(1)
-	t.executions = append(t.executions, math.Round(d.Seconds()*100)/100)
-	t.lastValue = math.Round(d.Seconds()*100) / 100
+	t.executions = t.retention.Retain(append(t.executions, TimerExecution{Time: now, Duration: d}), now)
+	t.lastValue = d
+	t.sum += d
+}
+
+// timerContext is the TimerContext returned by StandardTimer.Begin.
+type timerContext struct {
+	timer    *StandardTimer
+	start    time.Time
+	once     sync.Once
+	duration time.Duration
+}
+
+// Stop records the duration of the span on its timer. Only the first call
+// records the span, later calls return the same duration.
+func (c *timerContext) Stop() time.Duration {
+	c.once.Do(func() {
+		c.duration = time.Since(c.start)
+		c.timer.update(c.duration)
+	})
+	return c.duration
+}
+
+// MarshalMetric returns the values of the timer as output by a registry
+// with the default settings.
+func (t *StandardTimer) MarshalMetric() (interface{}, error) {
+	return t.marshalMetricWith(defaultExportOptions), nil
+}
+
+func (t *StandardTimer) marshalMetricWith(opts exportOptions) interface{} {
+	return timerValue(t, opts)
+}
+
+// createdTime returns the time the timer was created.
+func (t *StandardTimer) createdTime() time.Time { return createdTime(t.meter) }
+
+// timerValue returns the values a Timer is output as, in its own unit or
+// else the unit of the registry.
+func timerValue(t Timer, opts exportOptions) map[string]interface{} {
+	unit := t.Unit()
+	if unit == 0 {
+		unit = opts.timerUnit
+	}
+	executions := []float64{}
+	for _, d := range t.AllExecutions() {
+		executions = append(executions, durationIn(d, unit))
+	}
+	ps := t.Percentiles(opts.percentiles)
+	rate := t.Rate()
+	values := make(map[string]interface{})
+	values["count"] = t.Count()
+	values["min"] = durationIn(t.Min(), unit)
+	values["max"] = durationIn(t.Max(), unit)
+	values["mean"] = durationIn(t.Mean(), unit)
+	values["stddev"] = durationIn(t.StdDev(), unit)
+	values["sum"] = durationIn(t.Sum(), unit)
+	for i, p := range opts.percentiles {
+		values[percentileName(p)] = durationIn(ps[i], unit)
+	}
+	values["lastValue"] = durationIn(t.LastValue(), unit)
+	values["executions"] = executions
+	values["unit"] = unitName(unit)
+	values["rate"] = rate.Rate()
+	values["rate1"] = rate.Rate1()
+	values["rate5"] = rate.Rate5()
+	values["rate15"] = rate.Rate15()
+	return values
+}
+
+// durationIn returns the duration as a number of the given unit.
+func durationIn(d, unit time.Duration) float64 {
+	return float64(d) / float64(unit)
+}
+
+// unitName returns the abbreviation used to label values output in the
+// given unit.
+func unitName(unit time.Duration) string {
+	switch unit {
+	case time.Nanosecond:
+		return "ns"
+	case time.Microsecond:
+		return "µs"
+	case time.Millisecond:
+		return "ms"
+	case time.Second:
+		return "s"
+	}
+	return unit.String()
 }
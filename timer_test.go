@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"math"
+	"sync"
 	"testing"
 	"time"
 )
@@ -30,32 +31,47 @@ func TestTimerStartStop(t *testing.T) {
 	tm.Start()
 	time.Sleep(time.Millisecond * 200)
 	tm.Stop()
-	if elapsed := tm.LastValue(); elapsed < float64(0.2) || elapsed > float64(0.203) {
-		t.Errorf("tm.Mean(): %f != 0.2", elapsed)
+	if elapsed := tm.LastValue(); elapsed < 200*time.Millisecond || elapsed > 250*time.Millisecond {
+		t.Errorf("tm.LastValue(): %v != 200ms", elapsed)
 	}
 }
 
 func TestTimerTime(t *testing.T) {
 	tm := NewTimer()
 	tm.Time(func() { time.Sleep(time.Millisecond * 200) })
-	// Timer will never be exactly 0.2 due to timer overhead
-	if elapsed := tm.LastValue(); elapsed < float64(0.2) || elapsed > float64(0.203) {
-		t.Errorf("tm.LastValue(): %f != 0.2", elapsed)
+	// Timer will never be exactly 200ms due to timer overhead
+	if elapsed := tm.LastValue(); elapsed < 200*time.Millisecond || elapsed > 250*time.Millisecond {
+		t.Errorf("tm.LastValue(): %v != 200ms", elapsed)
 	}
 }
 
 func TestTimerMetrics(t *testing.T) {
-	tm := NewTimer()
-	tm.Time(func() { time.Sleep(time.Second * 1) })
-	tm.Time(func() { time.Sleep(time.Second * 2) })
-	if mean := tm.Mean(); mean != float64(1.5) {
-		t.Errorf("tm.Mean(): %f != 1.5", mean)
+	tm := NewTimer().(*StandardTimer)
+	tm.update(time.Second * 1)
+	tm.update(time.Second * 2)
+	if mean := tm.Mean(); mean != 1500*time.Millisecond {
+		t.Errorf("tm.Mean(): %v != 1.5s", mean)
+	}
+	if max := tm.Max(); max != 2*time.Second {
+		t.Errorf("tm.Max(): %v != 2s", max)
+	}
+	if min := tm.Min(); min != 1*time.Second {
+		t.Errorf("tm.Min(): %v != 1s", min)
+	}
+}
+
+func TestTimerSubSecond(t *testing.T) {
+	tm := NewTimer().(*StandardTimer)
+	tm.update(250 * time.Microsecond)
+	tm.update(750 * time.Microsecond)
+	if mean := tm.Mean(); mean != 500*time.Microsecond {
+		t.Errorf("tm.Mean(): %v != 500µs", mean)
 	}
-	if max := tm.Max(); max != 2 {
-		t.Errorf("tm.Max(): %d != 2", max)
+	if max := tm.Max(); max != 750*time.Microsecond {
+		t.Errorf("tm.Max(): %v != 750µs", max)
 	}
-	if min := tm.Min(); min != 1 {
-		t.Errorf("tm.Min(): %d != 1", min)
+	if min := tm.Min(); min != 250*time.Microsecond {
+		t.Errorf("tm.Min(): %v != 250µs", min)
 	}
 }
 
@@ -75,10 +91,237 @@ func TestTimerExecutions(t *testing.T) {
 	}
 }
 
+func TestTimerUnit(t *testing.T) {
+	r := NewRegistry()
+	tm := NewRegisteredTimer("foo", r)
+	tm.Update(1500 * time.Microsecond)
+
+	tm.SetUnit(time.Millisecond)
+	values := registryValues(t, r)["foo"].(map[string]interface{})
+	for _, key := range []string{"lastValue", "max", "mean", "min", "median", "99%", "sum"} {
+		if v := values[key]; 1.5 != v {
+			t.Errorf("%s: 1.5 != %v", key, v)
+		}
+	}
+	if ex := values["executions"].([]interface{}); 1 != len(ex) || 1.5 != ex[0] {
+		t.Errorf("executions: [1.5] != %v", ex)
+	}
+	if unit := values["unit"]; "ms" != unit {
+		t.Errorf("unit: ms != %v", unit)
+	}
+}
+
+func TestTimerRegistryUnit(t *testing.T) {
+	r := NewRegistry()
+	nested := NewRegistry()
+	r.Register("nested", nested)
+	NewRegisteredTimer("foo", nested).Update(1500 * time.Microsecond)
+	explicit := NewRegisteredTimer("bar", nested)
+	explicit.SetUnit(time.Second)
+	explicit.Update(1500 * time.Microsecond)
+
+	r.(*StandardRegistry).SetTimerUnit(time.Microsecond)
+	values := registryValues(t, r)["nested"].(map[string]interface{})
+	foo := values["foo"].(map[string]interface{})
+	if max, unit := foo["max"], foo["unit"]; 1500.0 != max || "µs" != unit {
+		t.Errorf("foo: 1500µs != %v%v", max, unit)
+	}
+	bar := values["bar"].(map[string]interface{})
+	if max, unit := bar["max"], bar["unit"]; 0.0015 != max || "s" != unit {
+		t.Errorf("bar: 0.0015s != %v%v", max, unit)
+	}
+}
+
+func TestTimerPercentiles(t *testing.T) {
+	tm := NewTimer()
+	for i := 1; i <= 100; i++ {
+		tm.Update(time.Duration(i) * time.Millisecond)
+	}
+	if p := tm.Percentile(0.5); 50500*time.Microsecond != p {
+		t.Errorf("tm.Percentile(0.5): 50.5ms != %v", p)
+	}
+	ps := tm.Percentiles([]float64{0.5, 0.99})
+	if 50500*time.Microsecond != ps[0] {
+		t.Errorf("median: 50.5ms != %v", ps[0])
+	}
+	if 99990*time.Microsecond != ps[1] {
+		t.Errorf("99th percentile: 99.99ms != %v", ps[1])
+	}
+	if sum := tm.Sum(); 5050*time.Millisecond != sum {
+		t.Errorf("tm.Sum(): 5.05s != %v", sum)
+	}
+	if stdDev := tm.StdDev(); 28866070 != stdDev {
+		t.Errorf("tm.StdDev(): 28.86607ms != %v", stdDev)
+	}
+}
+
+func TestTimerRate(t *testing.T) {
+	tm := NewTimer()
+	tm.Update(time.Second)
+	tm.Update(time.Second)
+	rate := tm.Rate()
+	if count := rate.Count(); 2 != count {
+		t.Errorf("tm.Rate().Count(): 2 != %v", count)
+	}
+	if r := rate.Rate(); r <= 0 {
+		t.Errorf("tm.Rate().Rate(): %v <= 0", r)
+	}
+	values := registryValues(t, registryWith("foo", tm))["foo"].(map[string]interface{})
+	for _, key := range []string{"rate", "rate1", "rate5", "rate15", "stddev", "median", "75%", "95%", "99%", "99.9%"} {
+		if _, ok := values[key]; !ok {
+			t.Errorf("%s is not output", key)
+		}
+	}
+}
+
 func TestGetOrRegisterTimer(t *testing.T) {
 	r := NewRegistry()
 	NewRegisteredTimer("foo", r).Time(func() { time.Sleep(time.Millisecond * 200) })
-	if tm := GetTimer("foo", r); 0.2 != math.Round(tm.LastValue()*10)/10 {
+	if tm := GetTimer("foo", r); 0.2 != math.Round(tm.LastValue().Seconds()*10)/10 {
 		t.Fatal(tm)
 	}
 }
+
+func TestTimerDefaultRetention(t *testing.T) {
+	tm := NewTimer().(*StandardTimer)
+	for i := 0; i < 2*DefaultTimerHistory; i++ {
+		tm.update(time.Duration(i))
+	}
+	ex := tm.AllExecutions()
+	if DefaultTimerHistory != len(ex) {
+		t.Fatalf("len(tm.AllExecutions()): %d != %d", DefaultTimerHistory, len(ex))
+	}
+	if last := ex[len(ex)-1]; time.Duration(2*DefaultTimerHistory-1) != last {
+		t.Errorf("last execution: %d != %v", 2*DefaultTimerHistory-1, last)
+	}
+	if count := tm.Count(); 2*DefaultTimerHistory != count {
+		t.Errorf("tm.Count(): %d != %v", 2*DefaultTimerHistory, count)
+	}
+}
+
+func TestTimerRetainNone(t *testing.T) {
+	tm := NewTimerWithOptions(WithTimerRetention(RetainNone()))
+	tm.Time(func() {})
+	if ex := tm.AllExecutions(); 0 != len(ex) {
+		t.Errorf("len(tm.AllExecutions()): 0 != %d", len(ex))
+	}
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v", count)
+	}
+}
+
+func TestTimerRetainWindow(t *testing.T) {
+	tm := NewTimerWithOptions(WithTimerRetention(RetainWindow(time.Minute))).(*StandardTimer)
+	now := time.Now()
+	tm.record(now.Add(-2*time.Minute), time.Second)
+	tm.record(now.Add(-30*time.Second), 2*time.Second)
+	tm.record(now, 3*time.Second)
+	ex := tm.AllExecutions()
+	if 2 != len(ex) {
+		t.Fatalf("len(tm.AllExecutions()): 2 != %d", len(ex))
+	}
+	if 2*time.Second != ex[0] || 3*time.Second != ex[1] {
+		t.Errorf("tm.AllExecutions(): %v", ex)
+	}
+}
+
+func TestTimerWithUnit(t *testing.T) {
+	if unit := NewTimerWithOptions(WithTimerUnit(time.Millisecond)).Unit(); time.Millisecond != unit {
+		t.Errorf("tm.Unit(): %v != 1ms", unit)
+	}
+}
+
+func TestTimerBegin(t *testing.T) {
+	tm := NewTimer()
+	outer := tm.Begin()
+	inner := tm.Begin()
+	time.Sleep(time.Millisecond * 20)
+	d := inner.Stop()
+	time.Sleep(time.Millisecond * 20)
+	outer.Stop()
+	if d != inner.Stop() {
+		t.Errorf("inner.Stop(): %v != %v", inner.Stop(), d)
+	}
+	if count := tm.Count(); 2 != count {
+		t.Errorf("tm.Count(): 2 != %v\n", count)
+	}
+	if min, max := tm.Min(), tm.Max(); min != d || max < min+20*time.Millisecond {
+		t.Errorf("tm.Min(): %v, tm.Max(): %v", min, max)
+	}
+}
+
+// exercise race detector
+func TestTimerBeginConcurrency(t *testing.T) {
+	tm := NewTimer()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tm.Begin().Stop()
+				tm.Start()
+				tm.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+	if count := tm.Count(); 2000 != count {
+		t.Errorf("tm.Count(): 2000 != %v\n", count)
+	}
+}
+
+func TestTimerUpdate(t *testing.T) {
+	tm := NewTimer()
+	tm.Update(time.Second)
+	tm.Update(3 * time.Second)
+	if mean := tm.Mean(); 2*time.Second != mean {
+		t.Errorf("tm.Mean(): %v != 2s", mean)
+	}
+	if last := tm.LastValue(); 3*time.Second != last {
+		t.Errorf("tm.LastValue(): %v != 3s", last)
+	}
+}
+
+func TestTimerUpdateSince(t *testing.T) {
+	tm := NewTimer()
+	tm.UpdateSince(time.Now().Add(-time.Second))
+	if last := tm.LastValue(); last < time.Second || last > time.Second+50*time.Millisecond {
+		t.Errorf("tm.LastValue(): %v != 1s", last)
+	}
+}
+
+func TestTimerWithSample(t *testing.T) {
+	tm := NewTimerWithOptions(WithTimerSample(NewSlidingWindowSample(2)))
+	tm.Update(time.Second)
+	tm.Update(2 * time.Second)
+	tm.Update(3 * time.Second)
+	if min := tm.Min(); 2*time.Second != min {
+		t.Errorf("tm.Min(): 2s != %v", min)
+	}
+	if count := tm.Count(); 3 != count {
+		t.Errorf("tm.Count(): 3 != %v", count)
+	}
+	if sum := tm.Sum(); 6*time.Second != sum {
+		t.Errorf("tm.Sum(): 6s != %v", sum)
+	}
+}
+
+func TestTimerStopMeter(t *testing.T) {
+	tm := NewTimer()
+	r := NewRegistry()
+	r.Register("foo", tm)
+	r.Unregister("foo")
+	meter := tm.(*StandardTimer).meter.(*StandardMeter)
+	if 0 != meter.stopped {
+		t.Errorf("timer passed to Register was stopped by Unregister\n")
+	}
+	tm.StopMeter()
+	if 1 != meter.stopped {
+		t.Errorf("tm.StopMeter() did not stop the meter\n")
+	}
+	tm.Update(time.Second)
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+}
@@ -0,0 +1,506 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Labels maps the label names of a metric vector to label values.
+type Labels map[string]string
+
+// MetricVecs hold one child metric for every set of label values they have
+// been given, such as one Counter per endpoint and method.
+type MetricVec interface {
+	ChildCount() int                                          // Number of label sets with a child metric
+	Delete(...string) bool                                    // Remove the child of the given label values
+	EachChild(func(labelValues []string, metric interface{})) // Call the function for each child, sorted by label values
+	LabelNames() []string                                     // Names of the labels, in order
+	Overflowed() int64                                        // Number of times a label set was redirected to the overflow child
+	Reset()                                                   // Remove every child
+	SetCardinalityLimit(int)                                  // Set the number of children at most, 0 for no limit
+}
+
+// labelSeparator joins label values into the key of a child. It cannot
+// occur in valid UTF-8, which label values are checked to be, so different
+// label sets never share a key.
+const labelSeparator = "\xff"
+
+// StandardMetricVec is the core of the standard metric vectors. It creates a
+// child metric the first time a set of label values is used. Once it holds as
+// many children as its cardinality limit, new label sets are redirected to a
+// child whose label values are all OverflowName. Label values must be valid
+// UTF-8, and With and WithLabelValues panic if one is not.
+type StandardMetricVec struct {
+	labelNames []string
+	newMetric  func() interface{}
+	overflowed int64
+	mutex      sync.RWMutex
+	children   map[string]*vecChild
+	limit      int
+}
+
+type vecChild struct {
+	labelValues []string
+	metric      interface{}
+}
+
+// newStandardMetricVec constructs a vector whose children are created by
+// newMetric. It panics if a label name is empty, repeated once sanitized for
+// the exposition formats, or one of the labels they add themselves, such as
+// le or quantile.
+func newStandardMetricVec(labelNames []string, newMetric func() interface{}) *StandardMetricVec {
+	seen := make(map[string]bool, len(labelNames))
+	for _, name := range labelNames {
+		sanitized := sanitizeName(name)
+		if name == "" || seen[sanitized] || reservedLabelNames[sanitized] {
+			panic(fmt.Sprintf("metrics: invalid label names %q", labelNames))
+		}
+		seen[sanitized] = true
+	}
+	v := &StandardMetricVec{
+		labelNames: make([]string, len(labelNames)),
+		newMetric:  newMetric,
+		children:   make(map[string]*vecChild),
+	}
+	copy(v.labelNames, labelNames)
+	return v
+}
+
+// ChildCount returns the number of label sets with a child metric.
+func (v *StandardMetricVec) ChildCount() int {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return len(v.children)
+}
+
+// Delete removes the child of the given label values, stopping it like
+// Registry.Unregister does. It returns false if there was no such child.
+func (v *StandardMetricVec) Delete(labelValues ...string) bool {
+	if len(labelValues) != len(v.labelNames) || !validLabelValues(labelValues) {
+		return false
+	}
+	key := strings.Join(labelValues, labelSeparator)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	child, ok := v.children[key]
+	if ok {
+		stopMetric(child.metric)
+		delete(v.children, key)
+	}
+	return ok
+}
+
+// EachChild calls the given function with the label values and metric of
+// each child, sorted by their label values.
+func (v *StandardMetricVec) EachChild(f func(labelValues []string, metric interface{})) {
+	v.mutex.RLock()
+	children := make([]*vecChild, 0, len(v.children))
+	for _, child := range v.children {
+		children = append(children, child)
+	}
+	v.mutex.RUnlock()
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i].labelValues, children[j].labelValues
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	for _, child := range children {
+		labelValues := make([]string, len(child.labelValues))
+		copy(labelValues, child.labelValues)
+		f(labelValues, child.metric)
+	}
+}
+
+// LabelNames returns the names of the labels, in the order label values are
+// given to WithLabelValues.
+func (v *StandardMetricVec) LabelNames() []string {
+	labelNames := make([]string, len(v.labelNames))
+	copy(labelNames, v.labelNames)
+	return labelNames
+}
+
+// Overflowed returns the number of times a new label set was redirected to
+// the overflow child because the cardinality limit was reached.
+func (v *StandardMetricVec) Overflowed() int64 {
+	return atomic.LoadInt64(&v.overflowed)
+}
+
+// Reset removes every child, stopping them like Registry.Unregister does.
+func (v *StandardMetricVec) Reset() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, child := range v.children {
+		stopMetric(child.metric)
+	}
+	v.children = make(map[string]*vecChild)
+}
+
+// SetCardinalityLimit sets the number of children the vector holds at most,
+// not counting the overflow child. A limit of 0 is unlimited, the default.
+// Existing children are kept when the limit is lowered.
+func (v *StandardMetricVec) SetCardinalityLimit(n int) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.limit = n
+}
+
+// withLabelValues returns the child of the given label values, creating it
+// if it does not exist yet. It panics if the number of label values differs
+// from the number of label names, a label value is not valid UTF-8, or the
+// label values are those of the overflow child, which are reserved.
+func (v *StandardMetricVec) withLabelValues(labelValues []string) interface{} {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %d label values %q given for labels %q", len(labelValues), labelValues, v.labelNames))
+	}
+	if !validLabelValues(labelValues) {
+		panic(fmt.Sprintf("metrics: label values %q are not valid UTF-8", labelValues))
+	}
+	if isOverflowLabelValues(labelValues) {
+		panic(fmt.Sprintf("metrics: label values %q are reserved for the overflow child", labelValues))
+	}
+	key := strings.Join(labelValues, labelSeparator)
+	v.mutex.RLock()
+	child, ok := v.children[key]
+	v.mutex.RUnlock()
+	if ok {
+		return child.metric
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child.metric
+	}
+	if v.limitReached() {
+		atomic.AddInt64(&v.overflowed, 1)
+		labelValues = make([]string, len(v.labelNames))
+		for i := range labelValues {
+			labelValues[i] = OverflowName
+		}
+		key = strings.Join(labelValues, labelSeparator)
+		if child, ok := v.children[key]; ok {
+			return child.metric
+		}
+	}
+	child = &vecChild{labelValues: make([]string, len(labelValues)), metric: v.newMetric()}
+	copy(child.labelValues, labelValues)
+	v.children[key] = child
+	return child.metric
+}
+
+// isOverflowLabelValues returns whether label values are those of the
+// overflow child: all OverflowName.
+func isOverflowLabelValues(labelValues []string) bool {
+	for _, value := range labelValues {
+		if value != OverflowName {
+			return false
+		}
+	}
+	return len(labelValues) > 0
+}
+
+// validLabelValues returns whether every label value is valid UTF-8.
+func validLabelValues(labelValues []string) bool {
+	for _, value := range labelValues {
+		if !utf8.ValidString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitReached returns whether the vector holds as many children, besides
+// the overflow child, as its cardinality limit allows.
+func (v *StandardMetricVec) limitReached() bool {
+	if v.limit <= 0 || 0 == len(v.labelNames) {
+		return false
+	}
+	n := len(v.children)
+	overflow := strings.Repeat(OverflowName+labelSeparator, len(v.labelNames)-1) + OverflowName
+	if _, ok := v.children[overflow]; ok {
+		n--
+	}
+	return n >= v.limit
+}
+
+// with returns the child of the given labels, creating it if it does not
+// exist yet. It panics if the labels are not exactly the label names, or a
+// label value is not valid UTF-8.
+func (v *StandardMetricVec) with(labels Labels) interface{} {
+	if len(labels) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: labels %v given for labels %q", labels, v.labelNames))
+	}
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		value, ok := labels[name]
+		if !ok {
+			panic(fmt.Sprintf("metrics: labels %v given for labels %q", labels, v.labelNames))
+		}
+		labelValues[i] = value
+	}
+	return v.withLabelValues(labelValues)
+}
+
+// MarshalMetric returns the values of the children as output by a registry
+// with the default settings, nested by label value.
+func (v *StandardMetricVec) MarshalMetric() (interface{}, error) {
+	return v.marshalMetricWith(defaultExportOptions), nil
+}
+
+func (v *StandardMetricVec) marshalMetricWith(opts exportOptions) interface{} {
+	return vecValue(v, opts)
+}
+
+// vecValue returns the values of the children of a vector nested by label
+// value, in the order of the label names.
+func vecValue(v MetricVec, opts exportOptions) interface{} {
+	depth := len(v.LabelNames())
+	var data interface{} = map[string]interface{}{}
+	v.EachChild(func(labelValues []string, metric interface{}) {
+		value, ok := serializeMetric(metric, opts)
+		if !ok {
+			return
+		}
+		if 0 == depth {
+			data = value
+			return
+		}
+		level := data.(map[string]interface{})
+		for _, labelValue := range labelValues[:depth-1] {
+			next, ok := level[labelValue].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				level[labelValue] = next
+			}
+			level = next
+		}
+		level[labelValues[depth-1]] = value
+	})
+	return data
+}
+
+// CounterVecs hold a Counter for every set of label values.
+type CounterVec interface {
+	MetricVec
+	With(Labels) Counter               // Counter of the given labels
+	WithLabelValues(...string) Counter // Counter of the given label values
+}
+
+// NewCounterVec constructs a new StandardCounterVec with the given label
+// names.
+func NewCounterVec(labelNames []string) CounterVec {
+	return &StandardCounterVec{newStandardMetricVec(labelNames, func() interface{} {
+		return NewCounter()
+	})}
+}
+
+// NewRegisteredCounterVec constructs and registers a new StandardCounterVec.
+func NewRegisteredCounterVec(name string, r Registry, labelNames []string) CounterVec {
+	c := NewCounterVec(labelNames)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetCounterVec returns an existing CounterVec
+func GetCounterVec(name string, r Registry) CounterVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(CounterVec)
+}
+
+// StandardCounterVec is the standard implementation of a CounterVec.
+type StandardCounterVec struct {
+	*StandardMetricVec
+}
+
+// With returns the Counter of the given labels, creating it if needed. It
+// panics if the labels are not exactly the vector's label names.
+func (v *StandardCounterVec) With(labels Labels) Counter {
+	return v.with(labels).(Counter)
+}
+
+// WithLabelValues returns the Counter of the given label values, creating it
+// if needed. It panics if the number of values is not the number of labels.
+func (v *StandardCounterVec) WithLabelValues(labelValues ...string) Counter {
+	return v.withLabelValues(labelValues).(Counter)
+}
+
+// GaugeVecs hold a Gauge for every set of label values.
+type GaugeVec interface {
+	MetricVec
+	With(Labels) Gauge               // Gauge of the given labels
+	WithLabelValues(...string) Gauge // Gauge of the given label values
+}
+
+// NewGaugeVec constructs a new StandardGaugeVec with the given label names.
+func NewGaugeVec(labelNames []string) GaugeVec {
+	return &StandardGaugeVec{newStandardMetricVec(labelNames, func() interface{} {
+		return NewGauge()
+	})}
+}
+
+// NewRegisteredGaugeVec constructs and registers a new StandardGaugeVec.
+func NewRegisteredGaugeVec(name string, r Registry, labelNames []string) GaugeVec {
+	c := NewGaugeVec(labelNames)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetGaugeVec returns an existing GaugeVec
+func GetGaugeVec(name string, r Registry) GaugeVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(GaugeVec)
+}
+
+// StandardGaugeVec is the standard implementation of a GaugeVec.
+type StandardGaugeVec struct {
+	*StandardMetricVec
+}
+
+// With returns the Gauge of the given labels, creating it if needed. It
+// panics if the labels are not exactly the vector's label names.
+func (v *StandardGaugeVec) With(labels Labels) Gauge {
+	return v.with(labels).(Gauge)
+}
+
+// WithLabelValues returns the Gauge of the given label values, creating it if
+// needed. It panics if the number of values is not the number of labels.
+func (v *StandardGaugeVec) WithLabelValues(labelValues ...string) Gauge {
+	return v.withLabelValues(labelValues).(Gauge)
+}
+
+// TimerVecs hold a Timer for every set of label values.
+type TimerVec interface {
+	MetricVec
+	With(Labels) Timer               // Timer of the given labels
+	WithLabelValues(...string) Timer // Timer of the given label values
+}
+
+// NewTimerVec constructs a new StandardTimerVec with the given label names,
+// whose timers are configured by the given options.
+// Be sure to register the vector with GetOrRegister, and unregister it once it
+// is of no use, or Reset it, to allow for garbage collection.
+func NewTimerVec(labelNames []string, opts ...TimerOption) TimerVec {
+	return &StandardTimerVec{newStandardMetricVec(labelNames, func() interface{} {
+		return NewTimerWithOptions(opts...)
+	})}
+}
+
+// NewRegisteredTimerVec constructs and registers a new StandardTimerVec.
+// Be sure to unregister the vector from the registry once it is of no use to
+// allow for garbage collection.
+func NewRegisteredTimerVec(name string, r Registry, labelNames []string, opts ...TimerOption) TimerVec {
+	c := NewTimerVec(labelNames, opts...)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetTimerVec returns an existing TimerVec
+func GetTimerVec(name string, r Registry) TimerVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(TimerVec)
+}
+
+// StandardTimerVec is the standard implementation of a TimerVec.
+type StandardTimerVec struct {
+	*StandardMetricVec
+}
+
+// With returns the Timer of the given labels, creating it if needed. It
+// panics if the labels are not exactly the vector's label names.
+func (v *StandardTimerVec) With(labels Labels) Timer {
+	return v.with(labels).(Timer)
+}
+
+// WithLabelValues returns the Timer of the given label values, creating it if
+// needed. It panics if the number of values is not the number of labels.
+func (v *StandardTimerVec) WithLabelValues(labelValues ...string) Timer {
+	return v.withLabelValues(labelValues).(Timer)
+}
+
+// HistogramVecs hold a Histogram for every set of label values.
+type HistogramVec interface {
+	MetricVec
+	With(Labels) Histogram               // Histogram of the given labels
+	WithLabelValues(...string) Histogram // Histogram of the given label values
+}
+
+// NewHistogramVec constructs a new StandardHistogramVec with the given label
+// names. Each histogram is given its own Sample made by newSample.
+func NewHistogramVec(labelNames []string, newSample func() Sample, opts ...HistogramOption) HistogramVec {
+	return &StandardHistogramVec{newStandardMetricVec(labelNames, func() interface{} {
+		return NewHistogram(newSample(), opts...)
+	})}
+}
+
+// NewRegisteredHistogramVec constructs and registers a new
+// StandardHistogramVec.
+func NewRegisteredHistogramVec(name string, r Registry, labelNames []string, newSample func() Sample, opts ...HistogramOption) HistogramVec {
+	c := NewHistogramVec(labelNames, newSample, opts...)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	err := registerCreated(r, name, c)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	return c
+}
+
+// GetHistogramVec returns an existing HistogramVec
+func GetHistogramVec(name string, r Registry) HistogramVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.Get(name).(HistogramVec)
+}
+
+// StandardHistogramVec is the standard implementation of a HistogramVec.
+type StandardHistogramVec struct {
+	*StandardMetricVec
+}
+
+// With returns the Histogram of the given labels, creating it if needed. It
+// panics if the labels are not exactly the vector's label names.
+func (v *StandardHistogramVec) With(labels Labels) Histogram {
+	return v.with(labels).(Histogram)
+}
+
+// WithLabelValues returns the Histogram of the given label values, creating
+// it if needed. It panics if the number of values is not the number of
+// labels.
+func (v *StandardHistogramVec) WithLabelValues(labelValues ...string) Histogram {
+	return v.withLabelValues(labelValues).(Histogram)
+}
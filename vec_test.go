@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func BenchmarkCounterVec(b *testing.B) {
+	v := NewCounterVec([]string{"endpoint", "method"})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.WithLabelValues("/users", "GET").Inc(1)
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	v := NewCounterVec([]string{"endpoint", "method"})
+	v.WithLabelValues("/users", "GET").Inc(1)
+	v.With(Labels{"method": "GET", "endpoint": "/users"}).Inc(2)
+	v.WithLabelValues("/users", "POST").Inc(5)
+	if count := v.WithLabelValues("/users", "GET").Count(); 3 != count {
+		t.Errorf("v.WithLabelValues(\"/users\", \"GET\").Count(): 3 != %v\n", count)
+	}
+	if count := v.ChildCount(); 2 != count {
+		t.Errorf("v.ChildCount(): 2 != %v\n", count)
+	}
+	if names := v.LabelNames(); !reflect.DeepEqual([]string{"endpoint", "method"}, names) {
+		t.Errorf("v.LabelNames(): [endpoint method] != %v\n", names)
+	}
+	if !v.Delete("/users", "POST") || v.Delete("/users", "POST") {
+		t.Errorf("v.Delete() did not delete the child once\n")
+	}
+	v.Reset()
+	if count := v.ChildCount(); 0 != count {
+		t.Errorf("v.ChildCount() after reset: 0 != %v\n", count)
+	}
+}
+
+func TestCounterVecConcurrent(t *testing.T) {
+	v := NewCounterVec([]string{"worker"})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				v.WithLabelValues("a").Inc(1)
+				v.WithLabelValues(string(rune('a' + j%4))).Inc(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := v.WithLabelValues("a").Count(); 10000 != count {
+		t.Errorf("v.WithLabelValues(\"a\").Count(): 10000 != %v\n", count)
+	}
+	if count := v.ChildCount(); 4 != count {
+		t.Errorf("v.ChildCount(): 4 != %v\n", count)
+	}
+}
+
+func TestMetricVecEachChild(t *testing.T) {
+	v := NewGaugeVec([]string{"pool", "state"})
+	v.WithLabelValues("b", "idle").Update(1)
+	v.WithLabelValues("a", "used").Update(2)
+	v.WithLabelValues("a", "idle").Update(3)
+	var labelValues [][]string
+	var values []int64
+	v.EachChild(func(lvs []string, metric interface{}) {
+		labelValues = append(labelValues, lvs)
+		values = append(values, metric.(Gauge).Value())
+	})
+	expected := [][]string{{"a", "idle"}, {"a", "used"}, {"b", "idle"}}
+	if !reflect.DeepEqual(expected, labelValues) {
+		t.Errorf("label values: %v != %v\n", expected, labelValues)
+	}
+	if !reflect.DeepEqual([]int64{3, 2, 1}, values) {
+		t.Errorf("values: [3 2 1] != %v\n", values)
+	}
+}
+
+func TestMetricVecCardinalityLimit(t *testing.T) {
+	v := NewCounterVec([]string{"user", "method"})
+	v.SetCardinalityLimit(2)
+	for i := 0; i < 5; i++ {
+		v.WithLabelValues(string(rune('a'+i)), "GET").Inc(1)
+	}
+	v.WithLabelValues("a", "GET").Inc(1)
+	if count := v.ChildCount(); 3 != count {
+		t.Errorf("v.ChildCount(): 3 != %v\n", count)
+	}
+	if count := v.WithLabelValues("a", "GET").Count(); 2 != count {
+		t.Errorf("v.WithLabelValues(\"a\", \"GET\").Count(): 2 != %v\n", count)
+	}
+	v.EachChild(func(labelValues []string, metric interface{}) {
+		if OverflowName != labelValues[0] {
+			return
+		}
+		if count := metric.(Counter).Count(); 3 != count {
+			t.Errorf("overflow count: 3 != %v\n", count)
+		}
+	})
+	if overflowed := v.Overflowed(); 3 != overflowed {
+		t.Errorf("v.Overflowed(): 3 != %v\n", overflowed)
+	}
+}
+
+func TestMetricVecInvalid(t *testing.T) {
+	v := NewCounterVec([]string{"endpoint", "method"})
+	for _, f := range []func(){
+		func() { NewCounterVec([]string{"a", "a"}) },
+		func() { NewCounterVec([]string{""}) },
+		func() { NewCounterVec([]string{"a.b", "a_b"}) },
+		func() { NewHistogramVec([]string{"quantile"}, func() Sample { return NewUniformSample(10) }) },
+		func() { NewCounterVec([]string{"le"}) },
+		func() { NewGaugeVec([]string{"index"}) },
+		func() { v.WithLabelValues("/users") },
+		func() { v.With(Labels{"endpoint": "/users"}) },
+		func() { v.With(Labels{"endpoint": "/users", "status": "200"}) },
+		func() { v.WithLabelValues("a\xffb", "c") },
+		func() { v.WithLabelValues(OverflowName, OverflowName) },
+		func() { v.With(Labels{"endpoint": OverflowName, "method": OverflowName}) },
+		func() { v.With(Labels{"endpoint": "/users", "method": "\xff"}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("did not panic\n")
+				}
+			}()
+			f()
+		}()
+	}
+	v.WithLabelValues("a", "b")
+	if v.Delete("a\xffb") || v.Delete("a\xff", "b") {
+		t.Errorf("v.Delete() deleted the child of other label values\n")
+	}
+}
+
+func TestTimerVec(t *testing.T) {
+	v := NewTimerVec([]string{"endpoint"}, WithTimerUnit(time.Millisecond))
+	v.WithLabelValues("/users").Update(5 * time.Millisecond)
+	timer := v.WithLabelValues("/users")
+	if count := timer.Count(); 1 != count {
+		t.Errorf("timer.Count(): 1 != %v\n", count)
+	}
+	if unit := timer.Unit(); time.Millisecond != unit {
+		t.Errorf("timer.Unit(): 1ms != %v\n", unit)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	v := NewHistogramVec([]string{"endpoint"}, func() Sample { return NewUniformSample(100) })
+	v.WithLabelValues("/a").Update(1)
+	v.WithLabelValues("/b").Update(2)
+	if h := v.WithLabelValues("/a"); 1 != h.Count() || 1 != h.Max() {
+		t.Errorf("v.WithLabelValues(\"/a\"): count %v, max %v\n", h.Count(), h.Max())
+	}
+}
+
+func TestGetCounterVec(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounterVec("foo", r, []string{"a"}).WithLabelValues("x").Inc(47)
+	if c := GetCounterVec("foo", r).WithLabelValues("x"); 47 != c.Count() {
+		t.Fatal(c)
+	}
+}
+
+func TestRegistryMetricVec(t *testing.T) {
+	r := NewRegistry()
+	requests := NewRegisteredCounterVec("requests", r, []string{"endpoint", "method"})
+	requests.WithLabelValues("/users", "GET").Inc(3)
+	requests.WithLabelValues("/users", "POST").Inc(1)
+	requests.WithLabelValues("/orders", "GET").Inc(2)
+	NewRegisteredTimerVec("latency", r, []string{"endpoint"}).WithLabelValues("/users").Update(time.Second)
+	NewRegisteredGaugeVec("all", r, nil).WithLabelValues().Update(7)
+
+	values := registryValues(t, r)
+	expected := map[string]interface{}{
+		"/users":  map[string]interface{}{"GET": 3.0, "POST": 1.0},
+		"/orders": map[string]interface{}{"GET": 2.0},
+	}
+	if !reflect.DeepEqual(expected, values["requests"]) {
+		t.Errorf("requests: %v != %v\n", expected, values["requests"])
+	}
+	latency := values["latency"].(map[string]interface{})["/users"].(map[string]interface{})
+	if count := latency["count"]; 1.0 != count {
+		t.Errorf("latency /users count: 1 != %v\n", count)
+	}
+	if all := values["all"]; 7.0 != all {
+		t.Errorf("all: 7 != %v\n", all)
+	}
+}